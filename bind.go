@@ -1,15 +1,18 @@
 package sqlx
 
 import (
-	"bytes"
 	"database/sql/driver"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/jmoiron/sqlx/sqllex"
 )
 
 // Bindvar types supported by Rebind, BindMap and BindStruct.
@@ -30,13 +33,28 @@ var defaultBinds = map[int][]string{
 
 var binds sync.Map
 
+// defaultBindLimits are the most bindvars a single query can have for some
+// drivers.  SQLite allows 32766 since 3.32.0, which go-sqlite3 has bundled
+// since v1.14.1, but only 999 before that.
+var defaultBindLimits = map[int][]string{
+	32766: {"sqlite3", "nrsqlite3"},
+	2100:  {"sqlserver", "azuresql"},
+	65535: {"postgres", "pgx", "pq-timeouts", "cloudsqlpostgres", "nrpostgres", "cockroach", "mysql", "nrmysql"},
+}
+
+var bindLimits sync.Map
+
 func init() {
 	for bind, drivers := range defaultBinds {
 		for _, driver := range drivers {
 			BindDriver(driver, bind)
 		}
 	}
-
+	for limit, drivers := range defaultBindLimits {
+		for _, driver := range drivers {
+			BindLimitDriver(driver, limit)
+		}
+	}
 }
 
 // BindType returns the bindtype for a given database given a drivername.
@@ -53,65 +71,327 @@ func BindDriver(driverName string, bindType int) {
 	binds.Store(driverName, bindType)
 }
 
-// FIXME: this should be able to be tolerant of escaped ?'s in queries without
-// losing much speed, and should be to avoid confusion.
+// BindLimit returns the most bindvars a query can have for driverName, or 0
+// if there is no known limit.  Batch inserts which would exceed it are split
+// into several queries, as are SelectIn queries where it is safe;  see SelectIn
+// and NamedExec.
+func BindLimit(driverName string) int {
+	limit, ok := bindLimits.Load(driverName)
+	if !ok {
+		return 0
+	}
+	return limit.(int)
+}
+
+// BindLimitDriver sets the BindLimit for driverName to limit.  A limit of 0
+// disables splitting queries for the driver.
+func BindLimitDriver(driverName string, limit int) {
+	bindLimits.Store(driverName, limit)
+}
+
+var namedArgs sync.Map
+
+// NamedArgs returns whether named queries for driverName are bound with a
+// sql.NamedArg for each param instead of a list of positional args.  It is
+// off for every driver until it is set with NamedArgsDriver.
+func NamedArgs(driverName string) bool {
+	native, ok := namedArgs.Load(driverName)
+	return ok && native.(bool)
+}
+
+// NamedArgsDriver sets whether NamedQuery, NamedExec and NamedStmt bind the
+// params of named queries for driverName with sql.NamedArg values.  The driver
+// must support sql.Named and bindvars like `@name` for the AT bindtype or
+// `:name` for any other, as sqlserver, godror and sqlite3 do.
+func NamedArgsDriver(driverName string, native bool) {
+	namedArgs.Store(driverName, native)
+}
+
+// dialectFor returns the sqllex.Dialect used to lex queries for bindType.
+func dialectFor(bindType int) sqllex.Dialect {
+	switch bindType {
+	case DOLLAR:
+		return sqllex.Postgres
+	case NAMED:
+		return sqllex.Oracle
+	case AT:
+		return sqllex.SQLServer
+	}
+	return sqllex.Generic
+}
+
+// driverDialect returns the sqllex.Dialect used to lex queries for driverName,
+// which is more precise than that of its bindtype for some databases.
+func driverDialect(driverName string) sqllex.Dialect {
+	switch driverName {
+	case "mysql", "nrmysql":
+		return sqllex.MySQL
+	case "sqlite3", "nrsqlite3":
+		return sqllex.SQLite
+	case "postgres", "pgx", "pq-timeouts", "cloudsqlpostgres", "nrpostgres", "cockroach":
+		return sqllex.Postgres
+	}
+	return dialectFor(BindType(driverName))
+}
+
+// lexDialect returns the dialect to lex query with when the query is written
+// for d.  Generic is used when the database is not known, and a query with `\'`
+// in it may have been written for MySQL, whose strings have backslash escapes;
+// if it only lexes without an unterminated literal using them, they are used.
+func lexDialect(query string, d sqllex.Dialect) sqllex.Dialect {
+	if d != sqllex.Generic || !strings.Contains(query, `\'`) || lexes(query, d) {
+		return d
+	}
+	escaped := d
+	escaped.BackslashEscapes = true
+	if lexes(query, escaped) {
+		return escaped
+	}
+	return d
+}
+
+// lexes returns whether query lexes with d without an unterminated literal.
+func lexes(query string, d sqllex.Dialect) bool {
+	l := sqllex.New(query, d)
+	for t := l.Next(); t.Kind != sqllex.EOF; t = l.Next() {
+	}
+	return l.Err() == nil
+}
+
+// A BindStyle formats the bindvar for a parameter of a query.  The index is
+// the 1-based position of the parameter in the query's argument list, and the
+// name is that of the named parameter it was bound from, including those in
+// each row of a batch insert;  it is empty for positional parameters, like
+// those of In and Rebind, and for each element of an expanded slice.  Since the
+// rows of a batch repeat names, a style should use the index to tell them
+// apart if the database binds args by name.
+type BindStyle func(index int, name string) string
+
+var (
+	bindStylesMu sync.Mutex
+	bindStyles   sync.Map
+	nextBindType = AT + 1
+)
+
+// RegisterBindStyle registers a bindvar type whose bindvars are formatted with
+// style and returns it.  The returned bindType works everywhere the builtin
+// types do;  use BindDriver to make it the bindtype for a driver:
+//
+//	oraclePositional := sqlx.RegisterBindStyle(func(index int, name string) string {
+//		return ":" + strconv.Itoa(index)
+//	})
+//	sqlx.BindDriver("oracle", oraclePositional)
+func RegisterBindStyle(style BindStyle) int {
+	bindStylesMu.Lock()
+	defer bindStylesMu.Unlock()
+	bindType := nextBindType
+	nextBindType++
+	bindStyles.Store(bindType, style)
+	return bindType
+}
+
+// appendBindvar appends the nth bindvar for bindType to b.  The name is used
+// by NAMED bindvars, which fall back to `:argN` if it is empty.
+func appendBindvar(b []byte, bindType, n int, name string) []byte {
+	switch bindType {
+	case QUESTION, UNKNOWN:
+		return append(b, '?')
+	case DOLLAR:
+		b = append(b, '$')
+	case NAMED:
+		if name != "" {
+			return append(append(b, ':'), name...)
+		}
+		b = append(b, ':', 'a', 'r', 'g')
+	case AT:
+		b = append(b, '@', 'p')
+	default:
+		if style, ok := bindStyles.Load(bindType); ok {
+			return append(b, style.(BindStyle)(n, name)...)
+		}
+	}
+	return strconv.AppendInt(b, int64(n), 10)
+}
 
 // Rebind a query from the default bindtype (QUESTION) to the target bindtype.
+//
+// Only `?` characters which are bindvars are rewritten;  those in string
+// literals, quoted identifiers, comments and dollar-quoted strings are left
+// alone, as are the `?|` and `?&` jsonb operators.  A literal `?` outside of
+// those (eg. the jsonb `?` operator) can be escaped as `??`, which is rebound
+// to a single `?`, as it is by Named and the methods which bind named queries.
+// When the target is QUESTION, the query is not modified.
+//
+// A query with an unterminated string literal, quoted identifier or comment,
+// which In, Named and RebindFrom return an error for, is returned unchanged, as
+// Rebind has no way to return the error.
 func Rebind(bindType int, query string) string {
+	rebound, err := rebind(bindType, query)
+	if err != nil {
+		return query
+	}
+	return rebound
+}
+
+// rebind is Rebind, returning an error for a query with an unterminated
+// literal or comment.
+func rebind(bindType int, query string) (string, error) {
 	switch bindType {
 	case QUESTION, UNKNOWN:
-		return query
+		return query, nil
 	}
 
+	if q, ok := rebindPlain(bindType, query); ok {
+		return q, nil
+	}
+	return rebindLex(bindType, query, dialectFor(bindType))
+}
+
+// rebindLex is rebind for any query, lexing it with d.
+func rebindLex(bindType int, query string, d sqllex.Dialect) (string, error) {
 	// Add space enough for 10 params before we have to allocate
 	rqb := make([]byte, 0, len(query)+10)
 
-	var i, j int
-
-	for i = strings.Index(query, "?"); i != -1; i = strings.Index(query, "?") {
-		rqb = append(rqb, query[:i]...)
+	var j, last int
 
-		switch bindType {
-		case DOLLAR:
-			rqb = append(rqb, '$')
-		case NAMED:
-			rqb = append(rqb, ':', 'a', 'r', 'g')
-		case AT:
-			rqb = append(rqb, '@', 'p')
+	l := sqllex.New(query, d)
+	for t := l.Next(); t.Kind != sqllex.EOF; t = l.Next() {
+		switch t.Kind {
+		case sqllex.Placeholder:
+			j++
+			rqb = append(rqb, query[last:t.Pos]...)
+			rqb = appendBindvar(rqb, bindType, j, "")
+		case sqllex.EscapedPlaceholder:
+			rqb = append(rqb, query[last:t.Pos]...)
+			rqb = append(rqb, '?')
+		default:
+			continue
 		}
+		last = t.Pos + len(t.Text)
+	}
+	if err := l.Err(); err != nil {
+		return "", err
+	}
 
-		j++
-		rqb = strconv.AppendInt(rqb, int64(j), 10)
+	return string(append(rqb, query[last:]...)), nil
+}
+
+// literalStarts has the characters which can start a literal or comment in one
+// dialect or another.  A query without any of them can be bound without lexing.
+const literalStarts = "'\"-/$`[#"
+
+// checkLiterals returns an error if query has an unterminated literal or
+// comment when lexed with d.
+func checkLiterals(query string, d sqllex.Dialect) error {
+	if !strings.ContainsAny(query, literalStarts) {
+		return nil
+	}
+	l := sqllex.New(query, d)
+	for t := l.Next(); t.Kind != sqllex.EOF; t = l.Next() {
+	}
+	return l.Err()
+}
 
-		query = query[i+1:]
+// rebindPlain is Rebind without the lexer, for the common queries which have
+// no quotes, comments, dollar signs or brackets, where every `?` is a bindvar
+// in any dialect, so that it gives the same query as rebindLex.  It returns
+// false for any other query.
+func rebindPlain(bindType int, query string) (string, bool) {
+	if strings.ContainsAny(query, literalStarts) {
+		return "", false
 	}
 
-	return string(append(rqb, query...))
+	// Add space enough for 10 params before we have to allocate
+	rqb := make([]byte, 0, len(query)+10)
+
+	var j, last int
+	for i := strings.IndexByte(query, '?'); i != -1; i = strings.IndexByte(query[last:], '?') {
+		i += last
+		if i+1 < len(query) {
+			switch query[i+1] {
+			case '?', '|', '&':
+				return "", false
+			}
+		}
+		j++
+		rqb = append(rqb, query[last:i]...)
+		rqb = appendBindvar(rqb, bindType, j, "")
+		last = i + 1
+	}
+	return string(append(rqb, query[last:]...)), true
 }
 
-// Experimental implementation of Rebind which uses a bytes.Buffer.  The code is
-// much simpler and should be more resistant to odd unicode, but it is twice as
-// slow.  Kept here for benchmarking purposes and to possibly replace Rebind if
-// problems arise with its somewhat naive handling of unicode.
-func rebindBuff(bindType int, query string) string {
-	if bindType != DOLLAR {
-		return query
+// Unbind converts a query from the DOLLAR or AT bindtype to QUESTION, which
+// is the reverse of Rebind.  Since `?` bindvars are positional, the returned
+// args are reordered to match, and args whose ordinal is used more than once
+// are repeated.  A `?` which is not a bindvar, like that of the postgres
+// jsonb `?`, `?|` and `?&` operators, is escaped as `??`.  It is an error for
+// the query to use an ordinal without an arg or for an arg not to be used, or
+// to have an unterminated literal or comment.
+func Unbind(bindType int, query string, args ...interface{}) (string, []interface{}, error) {
+	var prefix string
+	switch bindType {
+	case QUESTION, UNKNOWN:
+		return query, args, nil
+	case DOLLAR:
+		prefix = "$"
+	case AT:
+		prefix = "@"
+	default:
+		return "", nil, fmt.Errorf("cannot unbind bindtype %d", bindType)
 	}
 
-	b := make([]byte, 0, len(query))
-	rqb := bytes.NewBuffer(b)
-	j := 1
-	for _, r := range query {
-		if r == '?' {
-			rqb.WriteRune('$')
-			rqb.WriteString(strconv.Itoa(j))
-			j++
-		} else {
-			rqb.WriteRune(r)
+	buf := make([]byte, 0, len(query))
+	newArgs := make([]interface{}, 0, len(args))
+	used := make([]bool, len(args))
+
+	var last int
+	l := sqllex.New(query, dialectFor(bindType))
+	for t := l.Next(); t.Kind != sqllex.EOF; t = l.Next() {
+		switch {
+		case t.Kind == sqllex.Ordinal && strings.HasPrefix(t.Text, prefix):
+			n := t.Index()
+			if n < 1 || n > len(args) {
+				return "", nil, fmt.Errorf("bindvar %s has no argument", t.Text)
+			}
+			buf = append(append(buf, query[last:t.Pos]...), '?')
+			newArgs = append(newArgs, args[n-1])
+			used[n-1] = true
+		case t.Kind == sqllex.Placeholder:
+			buf = append(append(buf, query[last:t.Pos]...), '?', '?')
+		case t.Kind == sqllex.Operator && (t.Text == "?|" || t.Text == "?&"):
+			buf = append(append(buf, query[last:t.Pos]...), '?', '?', t.Text[1])
+		default:
+			continue
 		}
+		last = t.Pos + len(t.Text)
 	}
+	if err := l.Err(); err != nil {
+		return "", nil, err
+	}
+
+	for i := range used {
+		if !used[i] {
+			return "", nil, fmt.Errorf("argument %d is not used in the query", i+1)
+		}
+	}
+	return string(append(buf, query[last:]...)), newArgs, nil
+}
 
-	return rqb.String()
+// RebindFrom converts a query from the bindtype from to the bindtype to,
+// reordering and repeating args as needed.  See Unbind.
+func RebindFrom(from, to int, query string, args ...interface{}) (string, []interface{}, error) {
+	if from == to {
+		return query, args, nil
+	}
+	query, args, err := Unbind(from, query, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	if query, err = rebind(to, query); err != nil {
+		return "", nil, err
+	}
+	return query, args, nil
 }
 
 func asSliceForIn(i interface{}) (v reflect.Value, ok bool) {
@@ -120,6 +400,9 @@ func asSliceForIn(i interface{}) (v reflect.Value, ok bool) {
 	}
 
 	v = reflect.ValueOf(i)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return reflect.Value{}, false
+	}
 	t := reflectx.Deref(v.Type())
 
 	// Only expand slices
@@ -127,29 +410,149 @@ func asSliceForIn(i interface{}) (v reflect.Value, ok bool) {
 		return reflect.Value{}, false
 	}
 
-	// []byte is a driver.Value type so it should not be expanded
-	if t == reflect.TypeOf([]byte{}) {
+	// []byte is a driver.Value type so it should not be expanded, and
+	// neither should named []byte types like json.RawMessage
+	if t.Elem().Kind() == reflect.Uint8 {
 		return reflect.Value{}, false
+	}
 
+	return reflect.Indirect(v), true
+}
+
+// expandSliceArgs expands slice values in args the same way In does, but only
+// those for which expand is true.  If there are expanded slices, counts holds
+// the length of each of them and is zero for other args;  if there aren't,
+// counts is nil and args is returned as is.  Unlike In, driver.Valuer args are
+// never expanded.
+func expandSliceArgs(args []interface{}, expand []bool) (counts []int, expanded []interface{}, err error) {
+	var extra int
+	for i, arg := range args {
+		if !expand[i] {
+			continue
+		}
+		if _, ok := arg.(driver.Valuer); ok {
+			continue
+		}
+		v, ok := asSliceForIn(arg)
+		if !ok {
+			continue
+		}
+		if v.Len() == 0 {
+			return nil, nil, ErrEmptySlice
+		}
+		if counts == nil {
+			counts = make([]int, len(args))
+		}
+		counts[i] = v.Len()
+		extra += v.Len() - 1
+	}
+
+	if counts == nil {
+		return nil, args, nil
 	}
 
-	return v, true
+	expanded = make([]interface{}, 0, len(args)+extra)
+	for i, arg := range args {
+		if counts[i] == 0 {
+			expanded = append(expanded, arg)
+			continue
+		}
+		v, _ := asSliceForIn(arg)
+		expanded = appendReflectSlice(expanded, v, counts[i])
+	}
+	return counts, expanded, nil
 }
 
 // In expands slice values in args, returning the modified query string
 // and a new arg list that can be executed by a database. The `query` should
-// use the `?` bindVar.  The return value uses the `?` bindVar.
+// use the `?` bindVar.  The return value uses the `?` bindVar.  A slice of
+// tuples, which can be slices, arrays or structs, is expanded into a list of
+// groups like `(?, ?), (?, ?)` for queries like `(a, b) IN (?)`.  An empty
+// slice in args returns ErrEmptySlice;  use InPolicy to handle them otherwise.
+// Since the database isn't known, strings are lexed with standard escaping,
+// or with backslash escapes as in MySQL if the query only lexes with them.  An
+// unterminated string literal, quoted identifier or comment is an error.
 func In(query string, args ...interface{}) (string, []interface{}, error) {
+	return in(query, sqllex.Generic, inOptions{}, args)
+}
+
+// InPolicy is like In, but handles empty slices in args according to policy.
+func InPolicy(policy EmptySlicePolicy, query string, args ...interface{}) (string, []interface{}, error) {
+	return in(query, sqllex.Generic, inOptions{empty: policy}, args)
+}
+
+// ErrEmptySlice is returned by In when an empty slice is passed for a bindvar.
+var ErrEmptySlice = errors.New("empty slice passed to 'in' query")
+
+// EmptySlicePolicy controls how In handles an empty slice.  A list of zero
+// bindvars is not valid SQL, so the query has to be changed some other way.
+type EmptySlicePolicy int
+
+const (
+	// EmptySliceError returns ErrEmptySlice.  This is the default.
+	EmptySliceError EmptySlicePolicy = iota
+	// EmptySliceFalse rewrites the `x IN (?)` predicate an empty slice is
+	// bound to so that it is always false, and `x NOT IN (?)` so that it is
+	// always true.  If the left operand is more than a column, literal or
+	// function call, `IN (?)` is rewritten to `IN (NULL)` and `NOT IN (?)`
+	// returns an error, as there is no safe always-true form of it.
+	EmptySliceFalse
+	// EmptySliceNoRows makes SelectIn return no rows without running the
+	// query.  Elsewhere it returns ErrEmptySlice like EmptySliceError.
+	EmptySliceNoRows
+)
+
+// inOptions control how slice values are expanded by In and SelectIn.  They
+// are set with the options methods of DB and Tx, and a DB passes its own on to
+// every Tx and Conn it creates;  see inOptionsFor.
+type inOptions struct {
+	// arrays binds a slice which is the only bindvar in an `IN (?)` list as a
+	// single postgres array argument, rewriting the predicate to `= ANY(?)`
+	arrays bool
+	// empty is the policy for empty slices
+	empty EmptySlicePolicy
+	// noSplit passes a SelectIn query whose bindvars exceed the BindLimit of
+	// the driver to it as it is, instead of running it once for each chunk of
+	// its largest slice
+	noSplit bool
+}
+
+// bindIn expands slice values in args according to opts and rebinds the
+// query from QUESTION to the bindtype of driverName.  Array binding is only
+// used for DOLLAR.
+func bindIn(driverName string, opts inOptions, query string, args []interface{}) (string, []interface{}, error) {
+	bindType := BindType(driverName)
+	if bindType != DOLLAR {
+		opts.arrays = false
+	}
+	q, args, err := in(query, driverDialect(driverName), opts, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if q, err = rebind(bindType, q); err != nil {
+		return "", nil, err
+	}
+	return q, args, nil
+}
+
+// in is In, lexing query with the dialect d.
+func in(query string, d sqllex.Dialect, opts inOptions, args []interface{}) (string, []interface{}, error) {
 	// argMeta stores reflect.Value and length for slices and
 	// the value itself for non-slice arguments
 	type argMeta struct {
 		v      reflect.Value
 		i      interface{}
 		length int
+		empty  bool
+		// width is the number of values in each element of a slice of
+		// tuples, and fields the struct fields of each value if they are
+		// structs
+		width  int
+		fields [][]int
 	}
 
 	var flatArgsCount int
-	var anySlices bool
+	var anySlices, anyEmpty bool
 
 	var stackMeta [32]argMeta
 
@@ -173,11 +576,25 @@ func In(query string, args ...interface{}) (string, []interface{}, error) {
 			meta[i].length = v.Len()
 			meta[i].v = v
 
+			width, fields, err := tupleShape(v)
+			if err != nil {
+				return "", nil, err
+			}
+			meta[i].width, meta[i].fields = width, fields
+
 			anySlices = true
-			flatArgsCount += meta[i].length
+			if width > 0 {
+				flatArgsCount += meta[i].length * width
+			} else {
+				flatArgsCount += meta[i].length
+			}
 
 			if meta[i].length == 0 {
-				return "", nil, errors.New("empty slice passed to 'in' query")
+				if opts.empty != EmptySliceFalse {
+					return "", nil, ErrEmptySlice
+				}
+				meta[i].empty = true
+				anyEmpty = true
 			}
 		} else {
 			meta[i].i = arg
@@ -186,8 +603,12 @@ func In(query string, args ...interface{}) (string, []interface{}, error) {
 	}
 
 	// don't do any parsing if there aren't any slices;  note that this means
-	// some errors that we might have caught below will not be returned.
+	// some errors that we might have caught below will not be returned, but
+	// unterminated literals are still checked for, as they are by Named.
 	if !anySlices {
+		if err := checkLiterals(query, lexDialect(query, d)); err != nil {
+			return "", nil, err
+		}
 		return query, args, nil
 	}
 
@@ -196,9 +617,30 @@ func In(query string, args ...interface{}) (string, []interface{}, error) {
 	var buf strings.Builder
 	buf.Grow(len(query) + len(", ?")*flatArgsCount)
 
-	var arg, offset int
+	var arg, last int
+
+	// the last three tokens which weren't whitespace or comments, most
+	// recent first, used to recognize `IN (?)` lists
+	var recent [3]sqllex.Token
+
+	// every token which wasn't whitespace or a comment, only kept if there
+	// are empty slices to find the left operand of their IN predicate
+	var seen []sqllex.Token
+
+	l := sqllex.New(query, lexDialect(query, d))
+	for t := l.Next(); t.Kind != sqllex.EOF; t = l.Next() {
+		if anyEmpty && !isSpaceOrComment(t) {
+			seen = append(seen, t)
+		}
+
+		// escaped `??` are left for Rebind to unescape
+		if t.Kind != sqllex.Placeholder {
+			if !isSpaceOrComment(t) {
+				recent[2], recent[1], recent[0] = recent[1], recent[0], t
+			}
+			continue
+		}
 
-	for i := strings.IndexByte(query[offset:], '?'); i != -1; i = strings.IndexByte(query[offset:], '?') {
 		if arg >= len(meta) {
 			// if an argument wasn't passed, lets return an error;  this is
 			// not actually how database/sql Exec/Query works, but since we are
@@ -210,17 +652,84 @@ func In(query string, args ...interface{}) (string, []interface{}, error) {
 		argMeta := meta[arg]
 		arg++
 
+		if argMeta.empty {
+			start, end, not, ok := inList(l, recent)
+			if !ok {
+				return "", nil, errors.New("empty slice passed to 'in' query outside of an IN (?) list")
+			}
+			// drop the `[NOT] IN ( ?` tokens to find the operand before them
+			n := 3
+			if not {
+				n = 4
+			}
+			op, ok := inOperand(seen[:len(seen)-n])
+			seen = append(seen, sqllex.Token{Kind: sqllex.Operator, Text: ")", Pos: end - 1})
+			if ok && op >= last {
+				buf.WriteString(query[last:op])
+				if not {
+					buf.WriteString("(1=1)")
+				} else {
+					buf.WriteString("(1=0)")
+				}
+			} else if !not {
+				buf.WriteString(query[last:start])
+				buf.WriteString("IN (NULL)")
+			} else {
+				return "", nil, errors.New("empty slice passed to 'in' query for NOT IN with a complex left operand")
+			}
+			last = end
+			continue
+		}
+
 		// not a slice, continue.
 		// our questionmark will either be written before the next expansion
 		// of a slice or after the loop when writing the rest of the query
 		if argMeta.length == 0 {
-			offset = offset + i + 1
 			newArgs = append(newArgs, argMeta.i)
+			recent[2], recent[1], recent[0] = recent[1], recent[0], t
+			continue
+		}
+
+		if argMeta.width > 0 {
+			buf.WriteString(query[last:t.Pos])
+			for si := 0; si < argMeta.length; si++ {
+				if si > 0 {
+					buf.WriteString(", ")
+				}
+				buf.WriteByte('(')
+				for wi := 0; wi < argMeta.width; wi++ {
+					if wi > 0 {
+						buf.WriteString(", ")
+					}
+					buf.WriteByte('?')
+				}
+				buf.WriteByte(')')
+				newArgs = appendTuple(newArgs, argMeta.v.Index(si), argMeta.fields)
+			}
+			last = t.Pos + len(t.Text)
 			continue
 		}
 
+		if opts.arrays {
+			if start, end, not, ok := inList(l, recent); ok {
+				if anyEmpty {
+					seen = append(seen, sqllex.Token{Kind: sqllex.Operator, Text: ")", Pos: end - 1})
+				}
+				buf.WriteString(query[last:start])
+				if not {
+					buf.WriteString("<> ALL(?)")
+				} else {
+					buf.WriteString("= ANY(?)")
+				}
+				newArgs = append(newArgs, pgArray(appendReflectSlice(nil, argMeta.v, argMeta.length)))
+				last = end
+				continue
+			}
+		}
+
 		// write everything up to and including our ? character
-		buf.WriteString(query[:offset+i+1])
+		end := t.Pos + len(t.Text)
+		buf.WriteString(query[last:end])
 
 		for si := 1; si < argMeta.length; si++ {
 			buf.WriteString(", ?")
@@ -228,13 +737,14 @@ func In(query string, args ...interface{}) (string, []interface{}, error) {
 
 		newArgs = appendReflectSlice(newArgs, argMeta.v, argMeta.length)
 
-		// slice the query and reset the offset. this avoids some bookkeeping for
-		// the write after the loop
-		query = query[offset+i+1:]
-		offset = 0
+		last = end
 	}
 
-	buf.WriteString(query)
+	if err := l.Err(); err != nil {
+		return "", nil, err
+	}
+
+	buf.WriteString(query[last:])
 
 	if arg < len(meta) {
 		return "", nil, errors.New("number of bindVars less than number arguments")
@@ -243,6 +753,378 @@ func In(query string, args ...interface{}) (string, []interface{}, error) {
 	return buf.String(), newArgs, nil
 }
 
+// chunkIn splits args so that the query that In makes from each chunk has at
+// most limit bindvars.  Only the largest slice is split, and only if it is
+// bound in an `IN (?)` list where running the query once for each chunk gives
+// the same rows as running it once;  see splitsIn.  If the query doesn't need
+// to be split, or if opts.noSplit is set, the only chunk is args.
+func chunkIn(driverName string, opts inOptions, query string, args []interface{}, limit int) ([][]interface{}, error) {
+	if BindType(driverName) != DOLLAR {
+		opts.arrays = false
+	}
+	d := driverDialect(driverName)
+	_, flat, err := in(query, d, opts, args)
+	if err != nil {
+		return nil, err
+	}
+	if opts.noSplit || limit <= 0 || len(flat) <= limit || opts.arrays {
+		return [][]interface{}{args}, nil
+	}
+
+	big, size, width := -1, 0, 1
+	for i, arg := range args {
+		if _, ok := arg.(driver.Valuer); ok {
+			continue
+		}
+		v, ok := asSliceForIn(arg)
+		if !ok {
+			continue
+		}
+		w, _, err := tupleShape(v)
+		if err != nil {
+			return nil, err
+		}
+		if w == 0 {
+			w = 1
+		}
+		if v.Len()*w > size*width {
+			big, size, width = i, v.Len(), w
+		}
+	}
+
+	n := (limit - (len(flat) - size*width)) / width
+	if big < 0 || n < 1 || !splitsIn(query, d, big) {
+		return nil, fmt.Errorf("query has %d bindvars, which is more than the limit of %d", len(flat), limit)
+	}
+
+	v, _ := asSliceForIn(args[big])
+	chunks := make([][]interface{}, 0, (size+n-1)/n)
+	for i := 0; i < size; i += n {
+		j := i + n
+		if j > size {
+			j = size
+		}
+		chunk := append([]interface{}{}, args...)
+		chunk[big] = v.Slice(i, j).Interface()
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// splitsIn returns whether query can be run once for each part of the slice
+// bound to its nth bindvar, lexing query with the dialect d, and give the same
+// rows as running it once.  The bindvar has to be the only one in an `IN (?)`
+// list, but not a `NOT IN (?)` list, at the top level of the query, and there
+// can't be an aggregate, DISTINCT, GROUP BY, ORDER BY, LIMIT, OFFSET, FETCH,
+// window function or set operation at the top level, which would apply to the
+// rows of each part separately.
+func splitsIn(query string, d sqllex.Dialect, n int) bool {
+	var recent [3]sqllex.Token
+	var depth int
+	ok := false
+	l := sqllex.New(query, lexDialect(query, d))
+	for t := l.Next(); t.Kind != sqllex.EOF; t = l.Next() {
+		switch {
+		case isSpaceOrComment(t):
+			continue
+		case t.Kind == sqllex.Placeholder:
+			if n == 0 {
+				_, _, not, in := inList(l, recent)
+				if !in || not || depth != 1 {
+					return false
+				}
+				ok = true
+				// inList skipped the closing paren
+				depth--
+			}
+			n--
+		case t.Text == "(":
+			if depth == 0 && recent[0].Kind == sqllex.Word && aggregates[strings.ToUpper(recent[0].Text)] {
+				return false
+			}
+			depth++
+		case t.Text == ")":
+			depth--
+		case t.Kind == sqllex.Word && depth == 0 && rowKeywords[strings.ToUpper(t.Text)]:
+			return false
+		}
+		recent[2], recent[1], recent[0] = recent[1], recent[0], t
+	}
+	return ok
+}
+
+// rowKeywords are words which, at the top level of a query, make its rows more
+// than the rows it has for each part of an IN list put together.
+var rowKeywords = map[string]bool{
+	"DISTINCT": true, "GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true,
+	"OFFSET": true, "FETCH": true, "TOP": true, "OVER": true, "WINDOW": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "MINUS": true,
+}
+
+// aggregates are common aggregate functions.
+var aggregates = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true, "TOTAL": true,
+	"ARRAY_AGG": true, "STRING_AGG": true, "GROUP_CONCAT": true, "LISTAGG": true,
+	"JSON_AGG": true, "JSONB_AGG": true, "JSON_OBJECT_AGG": true, "JSONB_OBJECT_AGG": true,
+	"JSON_ARRAYAGG": true, "JSON_OBJECTAGG": true, "JSON_GROUP_ARRAY": true, "JSON_GROUP_OBJECT": true,
+	"BOOL_AND": true, "BOOL_OR": true, "EVERY": true, "BIT_AND": true, "BIT_OR": true, "BIT_XOR": true,
+	"STDDEV": true, "STDDEV_POP": true, "STDDEV_SAMP": true, "STDEV": true,
+	"VARIANCE": true, "VAR_POP": true, "VAR_SAMP": true, "VAR": true,
+}
+
+// isSpaceOrComment returns whether t is whitespace or a comment.
+func isSpaceOrComment(t sqllex.Token) bool {
+	switch t.Kind {
+	case sqllex.Space, sqllex.LineComment, sqllex.BlockComment:
+		return true
+	}
+	return false
+}
+
+// inList checks whether the placeholder last returned by l is the only item
+// in an `IN (?)` or `NOT IN (?)` list, given the tokens which preceded it.
+// If it is, l is advanced past the closing paren and the start and end of
+// the predicate (from the IN or NOT keyword to the paren) are returned.
+func inList(l *sqllex.Lexer, recent [3]sqllex.Token) (start, end int, not, ok bool) {
+	if recent[0].Text != "(" || recent[1].Kind != sqllex.Word || !strings.EqualFold(recent[1].Text, "IN") {
+		return 0, 0, false, false
+	}
+
+	peek := *l
+	t := peek.Next()
+	for isSpaceOrComment(t) {
+		t = peek.Next()
+	}
+	if t.Text != ")" {
+		return 0, 0, false, false
+	}
+	*l = peek
+
+	start, end = recent[1].Pos, t.Pos+1
+	if recent[2].Kind == sqllex.Word && strings.EqualFold(recent[2].Text, "NOT") {
+		start, not = recent[2].Pos, true
+	}
+	return start, end, not, true
+}
+
+// inOperand returns the position of the left operand of an IN predicate, given
+// the tokens before the IN or NOT IN, skipping whitespace and comments.  The
+// operand can be a column, literal, function call or parenthesized expression,
+// possibly qualified or cast with `::`.  It is not ok if there is a bindvar in
+// the operand or if it is part of a larger arithmetic expression, where the
+// extent of the operand can't be known without parsing the whole expression.
+func inOperand(toks []sqllex.Token) (pos int, ok bool) {
+	i := len(toks) - 1
+	for {
+		if i < 0 {
+			return 0, false
+		}
+		switch t := toks[i]; {
+		case t.Text == ")":
+			for depth := 0; ; i-- {
+				if i < 0 || toks[i].Kind == sqllex.Placeholder {
+					return 0, false
+				}
+				if toks[i].Text == ")" {
+					depth++
+				} else if toks[i].Text == "(" {
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			// a function call
+			if i > 0 && toks[i-1].Kind == sqllex.Word && !isKeyword(toks[i-1].Text) {
+				i--
+			}
+		case t.Kind == sqllex.Word && !isKeyword(t.Text):
+		case t.Kind == sqllex.QuotedIdent, t.Kind == sqllex.Number, t.Kind == sqllex.String:
+		default:
+			return 0, false
+		}
+		// qualified names and casts extend the operand to the left
+		if i >= 2 && (toks[i-1].Text == "." || toks[i-1].Kind == sqllex.DoubleColon) {
+			i -= 2
+			continue
+		}
+		break
+	}
+	if i > 0 && toks[i-1].Kind == sqllex.Operator && strings.Contains("+-*/%|&^~", toks[i-1].Text) {
+		return 0, false
+	}
+	return toks[i].Pos, true
+}
+
+// sqlKeywords are words which can come before the operand of a predicate, so
+// that they aren't mistaken for a column or function name.
+var sqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "WHERE": true, "ON": true, "WHEN": true,
+	"THEN": true, "ELSE": true, "END": true, "HAVING": true, "SELECT": true,
+	"SET": true, "CASE": true, "BY": true, "IS": true, "AS": true, "IN": true,
+	"EXISTS": true, "LIKE": true, "BETWEEN": true, "DISTINCT": true,
+	"USING": true, "FROM": true, "JOIN": true, "VALUES": true, "RETURNING": true,
+}
+
+func isKeyword(word string) bool {
+	return sqlKeywords[strings.ToUpper(word)]
+}
+
+// pgArray is a list of values which is bound as a postgres array.  Its Value
+// is the text representation of the array, which postgres will convert to the
+// type of array required by the query.
+type pgArray []interface{}
+
+// Value implements the driver.Valuer interface.
+func (a pgArray) Value() (driver.Value, error) {
+	b := make([]byte, 0, 2+len(a)*4)
+	b = append(b, '{')
+	for i, v := range a {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if valuer, ok := v.(driver.Valuer); ok {
+			var err error
+			if v, err = valuer.Value(); err != nil {
+				return nil, err
+			}
+		}
+		b = appendArrayElem(b, v)
+	}
+	return string(append(b, '}')), nil
+}
+
+// appendArrayElem appends the postgres array text representation of v to b.
+func appendArrayElem(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "NULL"...)
+	case []byte:
+		return appendArrayQuoted(b, `\x`+hex.EncodeToString(v))
+	case time.Time:
+		return appendArrayQuoted(b, v.Format(time.RFC3339Nano))
+	case string:
+		return appendArrayQuoted(b, v)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return append(b, "NULL"...)
+		}
+		return appendArrayElem(b, rv.Elem().Interface())
+	case reflect.Bool:
+		if rv.Bool() {
+			return append(b, 't')
+		}
+		return append(b, 'f')
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(b, rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(b, rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(b, rv.Float(), 'g', -1, 64)
+	case reflect.String:
+		return appendArrayQuoted(b, rv.String())
+	}
+	return appendArrayQuoted(b, fmt.Sprint(v))
+}
+
+// appendArrayQuoted appends s to b as a double quoted array element.
+func appendArrayQuoted(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, s[i])
+	}
+	return append(b, '"')
+}
+
+// tupleShape returns the number of values in each element of the slice v if
+// its elements are tuples, which are slices, arrays or structs that aren't
+// themselves values like []byte or time.Time.  If they are structs, fields are
+// the indexes of their fields.  Width is 0 if the elements aren't tuples.
+func tupleShape(v reflect.Value) (width int, fields [][]int, err error) {
+	t := v.Type().Elem()
+	ptr := t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
+	if ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return 0, nil, nil
+		}
+		return t.Len(), nil, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 || v.Len() == 0 {
+			return 0, nil, nil
+		}
+		width = v.Index(0).Len()
+		for i := 1; i < v.Len(); i++ {
+			if v.Index(i).Len() != width {
+				return 0, nil, errors.New("tuples passed to 'in' query have different lengths")
+			}
+		}
+		if width == 0 {
+			return 0, nil, errors.New("empty tuple passed to 'in' query")
+		}
+		return width, nil, nil
+	case reflect.Struct:
+		if t.Implements(_valuerInterface) || reflect.PtrTo(t).Implements(_valuerInterface) || isScannable(t) {
+			return 0, nil, nil
+		}
+		for i := 0; ptr && i < v.Len(); i++ {
+			if v.Index(i).IsNil() {
+				return 0, nil, errors.New("nil tuple passed to 'in' query")
+			}
+		}
+		fields = tupleFields(t, nil, nil)
+		return len(fields), fields, nil
+	}
+	return 0, nil, nil
+}
+
+// tupleFields appends the indexes of the exported fields of the struct type t
+// to fields in the order they are declared, flattening embedded structs and
+// skipping fields tagged `db:"-"`.
+func tupleFields(t reflect.Type, index []int, fields [][]int) [][]int {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if name := strings.Split(f.Tag.Get("db"), ",")[0]; name == "-" {
+			continue
+		}
+		fi := append(append([]int{}, index...), i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && !isScannable(f.Type) {
+			fields = tupleFields(f.Type, fi, fields)
+			continue
+		}
+		if f.PkgPath == "" {
+			fields = append(fields, fi)
+		}
+	}
+	return fields
+}
+
+// appendTuple appends the values in the tuple v to args.
+func appendTuple(args []interface{}, v reflect.Value, fields [][]int) []interface{} {
+	v = reflect.Indirect(v)
+	if fields == nil {
+		return appendReflectSlice(args, v, v.Len())
+	}
+	for _, fi := range fields {
+		args = append(args, v.FieldByIndex(fi).Interface())
+	}
+	return args
+}
+
 func appendReflectSlice(args []interface{}, v reflect.Value, vlen int) []interface{} {
 	switch val := v.Interface().(type) {
 	case []interface{}:
@@ -1,8 +1,15 @@
 package sqlx
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"math/rand"
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx/sqllex"
 )
 
 func oldBindType(driverName string) int {
@@ -77,3 +84,699 @@ func BenchmarkBindSpeed(b *testing.B) {
 
 	})
 }
+
+func TestRebindLiterals(t *testing.T) {
+	table := []struct {
+		name, q, dollar, at string
+	}{
+		{
+			name:   "plain",
+			q:      `INSERT INTO foo (a, b) VALUES (?, ?),(?,?)`,
+			dollar: `INSERT INTO foo (a, b) VALUES ($1, $2),($3,$4)`,
+			at:     `INSERT INTO foo (a, b) VALUES (@p1, @p2),(@p3,@p4)`,
+		},
+		{
+			name:   "plain concat",
+			q:      `SELECT ?||b FROM foo WHERE c = ?`,
+			dollar: `SELECT $1||b FROM foo WHERE c = $2`,
+			at:     `SELECT @p1||b FROM foo WHERE c = @p2`,
+		},
+		{
+			name:   "string literal",
+			q:      `SELECT * FROM foo WHERE a = ? AND b = 'what?'`,
+			dollar: `SELECT * FROM foo WHERE a = $1 AND b = 'what?'`,
+			at:     `SELECT * FROM foo WHERE a = @p1 AND b = 'what?'`,
+		},
+		{
+			name:   "escaped quote in literal",
+			q:      `SELECT 'it''s ?', ? FROM foo`,
+			dollar: `SELECT 'it''s ?', $1 FROM foo`,
+			at:     `SELECT 'it''s ?', @p1 FROM foo`,
+		},
+		{
+			name:   "quoted identifiers",
+			q:      `SELECT "a?", "b""?" FROM foo WHERE c = ?`,
+			dollar: `SELECT "a?", "b""?" FROM foo WHERE c = $1`,
+			at:     `SELECT "a?", "b""?" FROM foo WHERE c = @p1`,
+		},
+		{
+			name:   "comments",
+			q:      "SELECT * -- why?\nFROM foo /* what? */ WHERE a = ?",
+			dollar: "SELECT * -- why?\nFROM foo /* what? */ WHERE a = $1",
+			at:     "SELECT * -- why?\nFROM foo /* what? */ WHERE a = @p1",
+		},
+		{
+			name:   "dollar quoted",
+			q:      `SELECT $$a?$$, $fn$ b? $fn$, ?`,
+			dollar: `SELECT $$a?$$, $fn$ b? $fn$, $1`,
+		},
+		{
+			name:   "jsonb operators",
+			q:      `SELECT * FROM foo WHERE data ?| ? AND data ?& ? AND data ?? ?`,
+			dollar: `SELECT * FROM foo WHERE data ?| $1 AND data ?& $2 AND data ? $3`,
+		},
+		{
+			name:   "concat",
+			q:      `SELECT ?||'a'`,
+			dollar: `SELECT $1||'a'`,
+			at:     `SELECT @p1||'a'`,
+		},
+		{
+			name:   "unterminated literal",
+			q:      `SELECT ?, 'a?`,
+			dollar: `SELECT ?, 'a?`,
+			at:     `SELECT ?, 'a?`,
+		},
+	}
+
+	for _, test := range table {
+		if got := Rebind(DOLLAR, test.q); got != test.dollar {
+			t.Errorf("%s: expected %q, got %q", test.name, test.dollar, got)
+		}
+		if got := Rebind(QUESTION, test.q); got != test.q {
+			t.Errorf("%s: expected %q, got %q", test.name, test.q, got)
+		}
+		// dollar quotes and jsonb operators are postgres only
+		if test.at == "" {
+			continue
+		}
+		if got := Rebind(AT, test.q); got != test.at {
+			t.Errorf("%s: expected %q, got %q", test.name, test.at, got)
+		}
+	}
+
+	// Rebind has no error to return for an unterminated literal, so it leaves
+	// the query as it is, but everything else that lexes it returns one
+	for _, q := range [][2]string{{`SELECT ?, 'a?`, `SELECT :a, 'a?`}, {`SELECT ? /* a?`, `SELECT :a /* a?`}} {
+		q, nq := q[0], q[1]
+		if _, _, err := RebindFrom(QUESTION, DOLLAR, q, 1); err == nil {
+			t.Errorf("%s: expected an error from RebindFrom", q)
+		}
+		if _, _, err := In(q, 1); err == nil {
+			t.Errorf("%s: expected an error from In", q)
+		}
+		if _, _, err := bindIn("postgres", inOptions{}, q, []interface{}{1}); err == nil {
+			t.Errorf("%s: expected an error from DB.In", q)
+		}
+		if _, _, err := bindNamedMapper(DOLLAR, nq, map[string]interface{}{"a": 1}, mapper()); err == nil {
+			t.Errorf("%s: expected an error from Named", nq)
+		}
+	}
+}
+
+func TestRebindPlain(t *testing.T) {
+	custom := RegisterBindStyle(func(index int, name string) string {
+		return "{p" + strconv.Itoa(index) + "}"
+	})
+	bindTypes := []int{DOLLAR, AT, NAMED, custom}
+	dialects := []sqllex.Dialect{sqllex.Generic, sqllex.Postgres, sqllex.MySQL, sqllex.SQLite, sqllex.SQLServer, sqllex.Oracle}
+
+	table := []struct {
+		q     string
+		plain bool
+	}{
+		{`SELECT * FROM foo`, true},
+		{`SELECT * FROM foo WHERE a = ? AND b = ?`, true},
+		{`SELECT ?`, true},
+		{`SELECT ?, ?+?, f(?)`, true},
+		{`SELECT * FROM café WHERE crème = ? AND prix > ?`, true},
+		{`SELECT @p1, ? FROM foo WHERE a = @a`, true},
+		{`SELECT ?:: int, :a, ?`, true},
+		{`SELECT * FROM foo WHERE data ?? ?`, false},
+		{`SELECT ???`, false},
+		{`SELECT ??`, false},
+		{`SELECT * FROM foo WHERE data ?| ? AND data ?& ?`, false},
+		{`SELECT $1, ?`, false},
+		{`SELECT ? FROM foo WHERE a = $1 OR b = $2`, false},
+		{`SELECT ?, 'a?', "b?"`, false},
+		{"SELECT ? -- c?\nFROM foo", false},
+		{`SELECT ? /* c? */`, false},
+		{"SELECT ? # c?", false},
+		{"SELECT `a?`, [b?], ?", false},
+	}
+	for _, test := range table {
+		for _, bindType := range bindTypes {
+			plain, ok := rebindPlain(bindType, test.q)
+			if ok != test.plain {
+				t.Errorf("%s: expected the plain path to be %v, got %v", test.q, test.plain, ok)
+			}
+			if lexed, err := rebindLex(bindType, test.q, dialectFor(bindType)); err != nil || Rebind(bindType, test.q) != lexed {
+				t.Errorf("%s: Rebind for %d differs from the lexer: %q vs %q (%v)", test.q, bindType, Rebind(bindType, test.q), lexed, err)
+			}
+			if !ok {
+				continue
+			}
+			for _, d := range dialects {
+				lexed, err := rebindLex(bindType, test.q, d)
+				if err != nil {
+					t.Errorf("%s: %v", test.q, err)
+					continue
+				}
+				if plain != lexed {
+					t.Errorf("%s: for %d in %+v, the plain path gives %q but the lexer gives %q", test.q, bindType, d, plain, lexed)
+				}
+			}
+		}
+	}
+}
+
+func TestInLiterals(t *testing.T) {
+	table := []struct {
+		name, q, expect string
+		args            []interface{}
+		n               int
+	}{
+		{
+			name:   "string literal",
+			q:      `SELECT * FROM foo WHERE a = '?' AND b IN (?) AND c = ?`,
+			expect: `SELECT * FROM foo WHERE a = '?' AND b IN (?, ?, ?) AND c = ?`,
+			args:   []interface{}{[]int{1, 2, 3}, "c"},
+			n:      4,
+		},
+		{
+			name:   "comments",
+			q:      "SELECT * FROM foo -- a?\nWHERE b IN (?) /* ? */",
+			expect: "SELECT * FROM foo -- a?\nWHERE b IN (?, ?) /* ? */",
+			args:   []interface{}{[]string{"a", "b"}},
+			n:      2,
+		},
+		{
+			name:   "escaped",
+			q:      `SELECT * FROM foo WHERE data ?? ? AND b IN (?)`,
+			expect: `SELECT * FROM foo WHERE data ?? ? AND b IN (?, ?)`,
+			args:   []interface{}{"key", []int{1, 2}},
+			n:      3,
+		},
+	}
+
+	for _, test := range table {
+		q, args, err := In(test.q, test.args...)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if q != test.expect {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expect, q)
+		}
+		if len(args) != test.n {
+			t.Errorf("%s: expected %d args, got %d", test.name, test.n, len(args))
+		}
+	}
+
+	q, _, _ := In(`SELECT * FROM foo WHERE data ?? ? AND b IN (?)`, "key", []int{1, 2})
+	if q = Rebind(DOLLAR, q); q != `SELECT * FROM foo WHERE data ? $1 AND b IN ($2, $3)` {
+		t.Errorf("unexpected rebound query %q", q)
+	}
+}
+
+func TestInArrays(t *testing.T) {
+	q := `SELECT * FROM foo WHERE a = ? AND b IN (?) AND c NOT IN ( ? ) AND d IN (?, ?) AND e IN (?)`
+	args := []interface{}{1, []int{1, 2}, []string{"a", `b"c`}, []int{3}, 4, 5}
+
+	db := NewDb(nil, "postgres")
+	query, bound, err := db.InArrays().In(q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `SELECT * FROM foo WHERE a = $1 AND b = ANY($2) AND c <> ALL($3) AND d IN ($4, $5) AND e IN ($6)`
+	if query != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, query)
+	}
+	if len(bound) != 6 {
+		t.Fatalf("expected 6 args, got %d: %v", len(bound), bound)
+	}
+	for i, expect := range map[int]string{1: `{1,2}`, 2: `{"a","b\"c"}`} {
+		v, err := bound[i].(driver.Valuer).Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expect {
+			t.Errorf("expected %s, got %v", expect, v)
+		}
+	}
+
+	// without array mode, or for other bindtypes, slices are expanded
+	query, bound, err = db.In(q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `SELECT * FROM foo WHERE a = $1 AND b IN ($2, $3) AND c NOT IN ( $4, $5 ) AND d IN ($6, $7) AND e IN ($8)`
+	if query != expect || len(bound) != 8 {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s` (%d args)", expect, query, len(bound))
+	}
+
+	query, _, err = NewDb(nil, "sqlite3").InArrays().In(q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `SELECT * FROM foo WHERE a = ? AND b IN (?, ?) AND c NOT IN ( ?, ? ) AND d IN (?, ?) AND e IN (?)`
+	if query != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, query)
+	}
+}
+
+func TestInEmptySlices(t *testing.T) {
+	none := []int{}
+	table := []struct {
+		q      string
+		args   []interface{}
+		expect string
+		nargs  int
+	}{
+		{`SELECT * FROM foo WHERE a IN (?)`, []interface{}{none},
+			`SELECT * FROM foo WHERE (1=0)`, 0},
+		{`SELECT * FROM foo WHERE a = ? AND t.b NOT IN ( ? ) AND c IN (?)`, []interface{}{1, none, []int{1, 2}},
+			`SELECT * FROM foo WHERE a = ? AND (1=1) AND c IN (?, ?)`, 3},
+		{`SELECT * FROM foo WHERE lower(a::text) /* x */ IN (?) OR b = ?`, []interface{}{none, 2},
+			`SELECT * FROM foo WHERE (1=0) OR b = ?`, 1},
+		{`SELECT * FROM foo WHERE NOT (a) IN (?)`, []interface{}{none},
+			`SELECT * FROM foo WHERE NOT (1=0)`, 0},
+		{`SELECT * FROM foo WHERE "a" IN (?) AND b IN (?)`, []interface{}{none, none},
+			`SELECT * FROM foo WHERE (1=0) AND (1=0)`, 0},
+		// operands which can't be found safely fall back to IN (NULL)
+		{`SELECT * FROM foo WHERE a + b IN (?)`, []interface{}{none},
+			`SELECT * FROM foo WHERE a + b IN (NULL)`, 0},
+		{`SELECT * FROM foo WHERE coalesce(a, ?) IN (?)`, []interface{}{1, none},
+			`SELECT * FROM foo WHERE coalesce(a, ?) IN (NULL)`, 1},
+	}
+	for _, test := range table {
+		q, args, err := InPolicy(EmptySliceFalse, test.q, test.args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.q, err)
+			continue
+		}
+		if q != test.expect || len(args) != test.nargs {
+			t.Errorf("\nexpected: `%s` (%d args)\ngot:      `%s` (%d args)", test.expect, test.nargs, q, len(args))
+		}
+	}
+
+	errors := []string{
+		`SELECT * FROM foo WHERE a + b NOT IN (?)`,
+		`SELECT * FROM foo WHERE a = ?`,
+	}
+	for _, q := range errors {
+		if _, _, err := InPolicy(EmptySliceFalse, q, none); err == nil {
+			t.Errorf("%s: expected an error", q)
+		}
+	}
+	for _, policy := range []EmptySlicePolicy{EmptySliceError, EmptySliceNoRows} {
+		if _, _, err := InPolicy(policy, `SELECT * FROM foo WHERE a IN (?)`, none); err != ErrEmptySlice {
+			t.Errorf("expected ErrEmptySlice, got %v", err)
+		}
+	}
+
+	db := NewDb(nil, "postgres").EmptySlices(EmptySliceFalse)
+	q, _, err := db.In(`SELECT * FROM foo WHERE a = ? AND b NOT IN (?)`, 1, none)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM foo WHERE a = $1 AND (1=1)`; q != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, q)
+	}
+}
+
+func TestInTuples(t *testing.T) {
+	type Base struct {
+		Tenant int `db:"tenant_id"`
+	}
+	type key struct {
+		Base
+		User    string `db:"user_id"`
+		Ignored string `db:"-"`
+		hidden  string
+	}
+
+	q := `SELECT * FROM foo WHERE (tenant_id, user_id) IN (?) AND x = ?`
+	expect := `SELECT * FROM foo WHERE (tenant_id, user_id) IN ((?, ?), (?, ?)) AND x = ?`
+	want := []interface{}{1, "a", 2, "b", "x"}
+	table := []interface{}{
+		[][]interface{}{{1, "a"}, {2, "b"}},
+		[][2]interface{}{{1, "a"}, {2, "b"}},
+		[]key{{Base{1}, "a", "c", "d"}, {Base{2}, "b", "c", "d"}},
+		[]*key{{Base: Base{1}, User: "a"}, {Base: Base{2}, User: "b"}},
+	}
+	for _, arg := range table {
+		query, args, err := In(q, arg, "x")
+		if err != nil {
+			t.Errorf("%T: %v", arg, err)
+			continue
+		}
+		if query != expect {
+			t.Errorf("%T:\nexpected: `%s`\ngot:      `%s`", arg, expect, query)
+		}
+		if !reflect.DeepEqual(args, want) {
+			t.Errorf("%T: expected %v, got %v", arg, want, args)
+		}
+	}
+
+	// values which are slices or structs themselves are not tuples
+	values := []interface{}{
+		[][]byte{[]byte("a"), []byte("b")},
+		[][2]byte{{1, 2}, {3, 4}},
+		[]sql.NullString{{}, {}},
+		[]time.Time{{}, {}},
+	}
+	for _, arg := range values {
+		query, args, err := In(`SELECT * FROM foo WHERE a IN (?)`, arg)
+		if err != nil {
+			t.Errorf("%T: %v", arg, err)
+			continue
+		}
+		if query != `SELECT * FROM foo WHERE a IN (?, ?)` || len(args) != 2 {
+			t.Errorf("%T: got `%s` with %d args", arg, query, len(args))
+		}
+	}
+
+	errs := []interface{}{
+		[][]int{{1, 2}, {3}},
+		[][]int{{}},
+		[]*key{nil},
+	}
+	for _, arg := range errs {
+		if _, _, err := In(q, arg, "x"); err == nil {
+			t.Errorf("%T: expected an error", arg)
+		}
+	}
+
+	pairs := [][]int{{1, 2}, {3, 4}}
+	for driverName, expect := range map[string]string{
+		"postgres":  `SELECT * FROM foo WHERE (a, b) IN (($1, $2), ($3, $4)) AND c = $5`,
+		"sqlite3":   `SELECT * FROM foo WHERE (a, b) IN ((?, ?), (?, ?)) AND c = ?`,
+		"oci8":      `SELECT * FROM foo WHERE (a, b) IN ((:arg1, :arg2), (:arg3, :arg4)) AND c = :arg5`,
+		"sqlserver": `SELECT * FROM foo WHERE (a, b) IN ((@p1, @p2), (@p3, @p4)) AND c = @p5`,
+	} {
+		query, _, err := NewDb(nil, driverName).In(`SELECT * FROM foo WHERE (a, b) IN (?) AND c = ?`, pairs, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query != expect {
+			t.Errorf("%s:\nexpected: `%s`\ngot:      `%s`", driverName, expect, query)
+		}
+	}
+}
+
+func TestInDialects(t *testing.T) {
+	table := []struct {
+		driverName, q, expect string
+	}{
+		{"postgres", `SELECT E'it\'s ?' FROM foo WHERE a IN (?)`, `SELECT E'it\'s ?' FROM foo WHERE a IN ($1, $2)`},
+		{"mysql", `SELECT 'it\'s ?' FROM foo WHERE a IN (?)`, `SELECT 'it\'s ?' FROM foo WHERE a IN (?, ?)`},
+		{"mysql", "SELECT * FROM foo # why?\nWHERE a IN (?)", "SELECT * FROM foo # why?\nWHERE a IN (?, ?)"},
+		{"sqlite3", "SELECT [a?] FROM foo WHERE a IN (?)", "SELECT [a?] FROM foo WHERE a IN (?, ?)"},
+	}
+	for _, test := range table {
+		q, args, err := NewDb(nil, test.driverName).In(test.q, []int{1, 2})
+		if err != nil {
+			t.Errorf("%s: %s", test.driverName, err)
+			continue
+		}
+		if q != test.expect || len(args) != 2 {
+			t.Errorf("%s: expected %q with 2 args, got %q with %d", test.driverName, test.expect, q, len(args))
+		}
+	}
+
+	// the bindvar in the comment isn't counted when splitting the query
+	chunks, err := chunkIn("mysql", inOptions{}, "SELECT * FROM foo # a IN (?)\nWHERE a IN (?)", []interface{}{[]int{1, 2, 3}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("expected 2 chunks, got %d", len(chunks))
+	}
+}
+
+func TestBackslashEscapes(t *testing.T) {
+	m := map[string]interface{}{"id": 1}
+	q, args, err := Named(`INSERT INTO t (a, b) VALUES ('O\'Brien', :id)`, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `INSERT INTO t (a, b) VALUES ('O\'Brien', ?)`; q != expect || len(args) != 1 {
+		t.Errorf("expected %q with 1 arg, got %q with %v", expect, q, args)
+	}
+
+	q, args, err = In(`SELECT * FROM t WHERE a = 'O\'Brien' AND id IN (?)`, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM t WHERE a = 'O\'Brien' AND id IN (?, ?)`; q != expect || len(args) != 2 {
+		t.Errorf("expected %q with 2 args, got %q with %v", expect, q, args)
+	}
+
+	// the driver's dialect is used when it is known
+	q, args, err = NewDb(nil, "mysql").BindNamed(`SELECT 'a\':b', :id`, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT 'a\':b', ?`; q != expect || len(args) != 1 {
+		t.Errorf("expected %q with 1 arg, got %q with %v", expect, q, args)
+	}
+	q, _, err = NewDb(nil, "postgres").BindNamed(`SELECT 'C:\', :id`, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT 'C:\', $1`; q != expect {
+		t.Errorf("expected %q, got %q", expect, q)
+	}
+
+	// unterminated literals are an error rather than swallowing the query
+	if _, _, err := Named(`SELECT 'a, :id`, m); err == nil {
+		t.Error("expected an error for an unterminated string")
+	}
+	if _, _, err := In(`SELECT * FROM t WHERE id IN (?) /* a`, []int{1, 2}); err == nil {
+		t.Error("expected an error for an unterminated comment")
+	}
+}
+
+func TestChunkIn(t *testing.T) {
+	q := `SELECT * FROM foo WHERE a = ? AND b IN (?) AND c IN (?)`
+	args := []interface{}{1, []int{1, 2}, []int{1, 2, 3, 4, 5}}
+
+	chunks, err := chunkIn("", inOptions{}, q, args, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := [][]interface{}{
+		{1, []int{1, 2}, []int{1, 2}},
+		{1, []int{1, 2}, []int{3, 4}},
+		{1, []int{1, 2}, []int{5}},
+	}
+	if !reflect.DeepEqual(chunks, expect) {
+		t.Errorf("expected %v, got %v", expect, chunks)
+	}
+
+	chunks, err = chunkIn("", inOptions{}, q, args, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 {
+		t.Errorf("expected 1 chunk, got %d", len(chunks))
+	}
+
+	// tuples are split by element, not by bindvar
+	chunks, err = chunkIn("postgres", inOptions{}, `SELECT * FROM foo WHERE (a, b) IN (?)`, []interface{}{[][]int{{1, 2}, {3, 4}, {5, 6}}}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("expected 2 chunks, got %d", len(chunks))
+	}
+
+	// splitting these would change the result
+	queries := []string{
+		`SELECT * FROM foo WHERE a = ? AND b IN (?) AND c NOT IN (?)`,
+		`SELECT * FROM foo WHERE a = ? AND b IN (?) AND c = ANY(?)`,
+		`SELECT count(*) FROM foo WHERE a = ? AND b IN (?) AND c IN (?)`,
+		`SELECT a, MAX (b) FROM foo WHERE a = ? AND b IN (?) AND c IN (?)`,
+		`SELECT DISTINCT a FROM foo WHERE a = ? AND b IN (?) AND c IN (?)`,
+		`SELECT a FROM foo WHERE a = ? AND b IN (?) AND c IN (?) GROUP BY a`,
+		`SELECT * FROM foo WHERE a = ? AND b IN (?) AND c IN (?) ORDER BY a`,
+		`SELECT * FROM foo WHERE a = ? AND b IN (?) AND c IN (?) LIMIT 1`,
+		`SELECT * FROM foo WHERE a = ? AND b IN (?) AND c IN (?) OFFSET 1 ROWS`,
+		`SELECT * FROM foo WHERE a = ? AND b IN (?) AND c IN (?) FETCH FIRST 1 ROWS ONLY`,
+		`SELECT a, rank() OVER (ORDER BY b) FROM foo WHERE a = ? AND b IN (?) AND c IN (?)`,
+		`SELECT a FROM foo WHERE a = ? AND b IN (?) AND c IN (?) UNION SELECT a FROM bar`,
+		`SELECT * FROM foo WHERE a = ? AND b IN (?) AND NOT (c IN (?))`,
+	}
+	for _, q := range queries {
+		if _, err := chunkIn("", inOptions{}, q, args, 5); err == nil {
+			t.Errorf("%s: expected an error", q)
+		}
+	}
+	if _, err := chunkIn("", inOptions{}, q, args, 3); err == nil {
+		t.Error("expected an error when the other bindvars leave no room")
+	}
+
+	// nested queries don't change the rows of the top level
+	q2 := `SELECT a, (SELECT max(x) FROM bar WHERE bar.a = foo.a) FROM foo WHERE a = ? AND b IN (?) AND c IN (?) AND d IN (SELECT DISTINCT d FROM baz ORDER BY d LIMIT 5)`
+	if chunks, err := chunkIn("", inOptions{}, q2, args, 5); err != nil || len(chunks) != 3 {
+		t.Errorf("expected 3 chunks, got %d (%v)", len(chunks), err)
+	}
+
+	// queries aren't split if it is turned off
+	if chunks, err := chunkIn("", inOptions{noSplit: true}, q, args, 5); err != nil || len(chunks) != 1 {
+		t.Errorf("expected 1 chunk, got %d (%v)", len(chunks), err)
+	}
+}
+
+func TestRegisterBindStyle(t *testing.T) {
+	positional := RegisterBindStyle(func(index int, name string) string {
+		return ":" + strconv.Itoa(index)
+	})
+	typed := RegisterBindStyle(func(index int, name string) string {
+		if name == "" {
+			name = "p" + strconv.Itoa(index)
+		}
+		return "{" + name + ":String}"
+	})
+	if positional == typed || positional <= AT || typed <= AT {
+		t.Fatalf("expected new bindtypes, got %d and %d", positional, typed)
+	}
+
+	q := `SELECT * FROM foo WHERE a = ? AND b = '?' AND c = ??`
+	if got := Rebind(positional, q); got != `SELECT * FROM foo WHERE a = :1 AND b = '?' AND c = ?` {
+		t.Errorf("unexpected rebind: %s", got)
+	}
+
+	BindDriver("test-typed", typed)
+	db := NewDb(nil, "test-typed")
+	query, args, err := db.BindNamed(`SELECT * FROM foo WHERE a = :a AND b IN (:b)`, map[string]interface{}{
+		"a": 1,
+		"b": []int{2, 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM foo WHERE a = {a:String} AND b IN ({p2:String}, {p3:String})`; query != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, query)
+	}
+	if len(args) != 3 {
+		t.Errorf("expected 3 args, got %d", len(args))
+	}
+
+	// the rows of a batch insert are bound with their names too
+	rows := []map[string]interface{}{{"a": 1, "b": 2, "c": 5}, {"a": 3, "b": 4, "c": 5}}
+	query, args, err = db.BindNamed(`INSERT INTO foo (a, b) VALUES (:a, :b) RETURNING :c`, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `INSERT INTO foo (a, b) VALUES ({a:String}, {b:String}),({a:String}, {b:String}) RETURNING {c:String}`; query != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, query)
+	}
+	if len(args) != 5 {
+		t.Errorf("expected 5 args, got %d", len(args))
+	}
+	query, _, err = bindNamedMapper(positional, `INSERT INTO foo (a, b) VALUES (:a, :b) RETURNING :c`, rows, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `INSERT INTO foo (a, b) VALUES (:1, :2),(:3, :4) RETURNING :5`; query != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, query)
+	}
+
+	query, _, err = db.In(`SELECT * FROM foo WHERE a IN (?)`, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM foo WHERE a IN ({p1:String}, {p2:String})`; query != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, query)
+	}
+}
+
+func TestUnbind(t *testing.T) {
+	table := []struct {
+		bindType int
+		q        string
+		args     []interface{}
+		expect   string
+		eargs    []interface{}
+	}{
+		{DOLLAR, `SELECT * FROM foo WHERE a = $2 AND b = $1`, []interface{}{1, 2},
+			`SELECT * FROM foo WHERE a = ? AND b = ?`, []interface{}{2, 1}},
+		{DOLLAR, `SELECT * FROM foo WHERE a = $1 OR b = $1 AND c = '$2' AND d::jsonb ? 'e' AND f = $2`, []interface{}{1, 2},
+			`SELECT * FROM foo WHERE a = ? OR b = ? AND c = '$2' AND d::jsonb ?? 'e' AND f = ?`, []interface{}{1, 1, 2}},
+		{DOLLAR, `SELECT d ?| $1 AND d ?& $2`, []interface{}{1, 2},
+			`SELECT d ??| ? AND d ??& ?`, []interface{}{1, 2}},
+		{AT, `SELECT * FROM foo WHERE a = @p2 AND [@p1] = @p1`, []interface{}{1, 2},
+			`SELECT * FROM foo WHERE a = ? AND [@p1] = ?`, []interface{}{2, 1}},
+		{QUESTION, `SELECT * FROM foo WHERE a = ?`, []interface{}{1},
+			`SELECT * FROM foo WHERE a = ?`, []interface{}{1}},
+	}
+	for _, test := range table {
+		q, args, err := Unbind(test.bindType, test.q, test.args...)
+		if err != nil {
+			t.Errorf("%s: %v", test.q, err)
+			continue
+		}
+		if q != test.expect {
+			t.Errorf("\nexpected: `%s`\ngot:      `%s`", test.expect, q)
+		}
+		if !reflect.DeepEqual(args, test.eargs) {
+			t.Errorf("%s: expected args %v, got %v", test.q, test.eargs, args)
+		}
+	}
+
+	errs := []struct {
+		bindType int
+		q        string
+		args     []interface{}
+	}{
+		{DOLLAR, `SELECT * FROM foo WHERE a = $2`, []interface{}{1}},
+		{DOLLAR, `SELECT * FROM foo WHERE a = $1`, []interface{}{1, 2}},
+		{DOLLAR, `SELECT * FROM foo WHERE a = $0`, []interface{}{}},
+		{NAMED, `SELECT * FROM foo WHERE a = :a`, []interface{}{1}},
+	}
+	for _, test := range errs {
+		if _, _, err := Unbind(test.bindType, test.q, test.args...); err == nil {
+			t.Errorf("%s: expected an error", test.q)
+		}
+	}
+
+	q, args, err := NewDb(nil, "sqlserver").RebindFrom(DOLLAR, `SELECT * FROM foo WHERE a = $2 AND b ? $1`, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM foo WHERE a = @p1 AND b ? @p2`; q != expect || !reflect.DeepEqual(args, []interface{}{2, 1}) {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s` %v", expect, q, args)
+	}
+
+	// the jsonb ?| and ?& operators aren't mistaken for bindvars
+	for _, to := range []int{AT, DOLLAR, QUESTION} {
+		q, args, err = RebindFrom(DOLLAR, to, `SELECT d ?| $1, d ?& $1`, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := map[int]string{
+			AT:       `SELECT d ?| @p1, d ?& @p2`,
+			DOLLAR:   `SELECT d ?| $1, d ?& $1`,
+			QUESTION: `SELECT d ??| ?, d ??& ?`,
+		}[to]
+		if q != expect || len(args) != map[int]int{AT: 2, DOLLAR: 1, QUESTION: 2}[to] {
+			t.Errorf("\nexpected: `%s`\ngot:      `%s` %v", expect, q, args)
+		}
+	}
+}
+
+func TestPgArrayValue(t *testing.T) {
+	s := "x"
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	table := []struct {
+		a      pgArray
+		expect string
+	}{
+		{pgArray{1, int64(-2), uint8(3)}, `{1,-2,3}`},
+		{pgArray{1.5, true, false}, `{1.5,t,f}`},
+		{pgArray{nil, &s, (*string)(nil)}, `{NULL,"x",NULL}`},
+		{pgArray{`a\b`, []byte{0xde, 0xad}}, `{"a\\b","\\xdead"}`},
+		{pgArray{ts, sql.NullString{}}, `{"2020-01-02T03:04:05Z",NULL}`},
+	}
+	for _, test := range table {
+		v, err := test.a.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != test.expect {
+			t.Errorf("expected %s, got %v", test.expect, v)
+		}
+	}
+}
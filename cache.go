@@ -0,0 +1,175 @@
+package sqlx
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/jmoiron/sqlx/sqllex"
+)
+
+// QueryCache is a bounded, concurrency safe LRU cache of compiled named queries
+// and rebound queries, keyed by bindtype, dialect and query.  Ad-hoc named queries like
+// NamedExec and NamedQuery are otherwise compiled every time they are run, and
+// DB.Rebind rebuilds its query every time it is called.  A DB uses a QueryCache
+// once it is set with DB.CacheQueries, and one cache can be shared by many DBs.
+type QueryCache struct {
+	mu     sync.Mutex
+	size   int
+	lru    *list.List
+	items  map[cacheKey]*list.Element
+	hits   uint64
+	misses uint64
+}
+
+// QueryCacheStats are the hit and miss counts and the number of queries in a
+// QueryCache.
+type QueryCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Len    int
+}
+
+// the kinds of query in a QueryCache
+const (
+	cacheRebind = iota
+	cacheNamed
+	cacheBatch
+)
+
+type cacheKey struct {
+	kind     int
+	bindType int
+	dialect  sqllex.Dialect
+	query    string
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value interface{}
+}
+
+// NewQueryCache returns a QueryCache which holds up to size queries.
+func NewQueryCache(size int) *QueryCache {
+	if size < 1 {
+		size = 1
+	}
+	return &QueryCache{
+		size:  size,
+		lru:   list.New(),
+		items: make(map[cacheKey]*list.Element, size),
+	}
+}
+
+// Stats returns the current stats of the cache.
+func (c *QueryCache) Stats() QueryCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return QueryCacheStats{Hits: c.hits, Misses: c.misses, Len: c.lru.Len()}
+}
+
+// Purge removes every query from the cache.  The stats are not reset.
+func (c *QueryCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[cacheKey]*list.Element, c.size)
+}
+
+func (c *QueryCache) get(key cacheKey) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.hits++
+		c.lru.MoveToFront(e)
+		return e.Value.(*cacheEntry).value, true
+	}
+	c.misses++
+	return nil, false
+}
+
+func (c *QueryCache) add(key cacheKey, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.lru.MoveToFront(e)
+		e.Value.(*cacheEntry).value = value
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, value: value})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// parseNamed returns the parsed named query for query and bindType, lexed
+// with d.  The result is shared and must not be modified.  A nil cache parses
+// every time.
+func (c *QueryCache) parseNamed(query string, bindType int, d sqllex.Dialect) (*namedQuery, error) {
+	if c == nil {
+		return parseNamedQuery([]byte(query), d)
+	}
+	key := cacheKey{kind: cacheNamed, bindType: bindType, dialect: d, query: query}
+	if v, ok := c.get(key); ok {
+		return v.(*namedQuery), nil
+	}
+	nq, err := parseNamedQuery([]byte(query), d)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, nq)
+	return nq, nil
+}
+
+// parseBatch returns the parsed batch query for query and bindType, lexed
+// with d.  The result is shared and must not be modified.  A nil cache parses
+// every time.
+func (c *QueryCache) parseBatch(query string, bindType int, d sqllex.Dialect) (*batchQuery, error) {
+	if c == nil {
+		return parseBatchQuery(query, d)
+	}
+	key := cacheKey{kind: cacheBatch, bindType: bindType, dialect: d, query: query}
+	if v, ok := c.get(key); ok {
+		return v.(*batchQuery), nil
+	}
+	bq, err := parseBatchQuery(query, d)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, bq)
+	return bq, nil
+}
+
+// rebind is Rebind, using the cache if it isn't nil.
+func (c *QueryCache) rebind(bindType int, query string) string {
+	if c == nil {
+		return Rebind(bindType, query)
+	}
+	switch bindType {
+	case QUESTION, UNKNOWN:
+		return query
+	}
+	key := cacheKey{kind: cacheRebind, bindType: bindType, query: query}
+	if v, ok := c.get(key); ok {
+		return v.(string)
+	}
+	rebound := Rebind(bindType, query)
+	c.add(key, rebound)
+	return rebound
+}
+
+func cacheFor(i interface{}) *QueryCache {
+	switch i := i.(type) {
+	case DB:
+		return i.cache
+	case *DB:
+		return i.cache
+	case Tx:
+		return i.cache
+	case *Tx:
+		return i.cache
+	default:
+		return nil
+	}
+}
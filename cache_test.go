@@ -0,0 +1,106 @@
+package sqlx
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx/sqllex"
+)
+
+func TestQueryCache(t *testing.T) {
+	c := NewQueryCache(2)
+	q := `SELECT * FROM foo WHERE a = :a AND b = :b`
+
+	for i := 0; i < 3; i++ {
+		nq, err := c.parseNamed(q, DOLLAR, dialectFor(DOLLAR))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nq.names) != 2 {
+			t.Errorf("expected 2 names, got %v", nq.names)
+		}
+	}
+	if s := c.Stats(); s.Hits != 2 || s.Misses != 1 || s.Len != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// the bindtype is part of the key
+	if _, err := c.parseNamed(q, QUESTION, dialectFor(QUESTION)); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Stats(); s.Misses != 2 || s.Len != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// the DOLLAR query is the least recently used, so it is evicted
+	if got := c.rebind(DOLLAR, `SELECT ?`); got != `SELECT $1` {
+		t.Errorf("unexpected rebind %s", got)
+	}
+	c.parseNamed(q, QUESTION, dialectFor(QUESTION))
+	c.parseNamed(q, DOLLAR, dialectFor(DOLLAR))
+	if s := c.Stats(); s.Hits != 3 || s.Misses != 4 || s.Len != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// errors are not cached
+	if _, err := c.parseNamed(`SELECT :a:b`, QUESTION, dialectFor(QUESTION)); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := c.parseNamed(`SELECT :a:b`, QUESTION, dialectFor(QUESTION)); err == nil {
+		t.Error("expected an error")
+	}
+	if s := c.Stats(); s.Misses != 6 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// and so is the dialect
+	if _, err := c.parseNamed(q, QUESTION, sqllex.MySQL); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Stats(); s.Misses != 7 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	c.Purge()
+	if s := c.Stats(); s.Len != 0 {
+		t.Errorf("expected an empty cache, got %+v", s)
+	}
+}
+
+func TestQueryCacheDB(t *testing.T) {
+	c := NewQueryCache(100)
+	db := NewDb(nil, "postgres").CacheQueries(c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				q, _, err := db.BindNamed(`SELECT * FROM foo WHERE a = :a AND b = `+strconv.Itoa(j), map[string]interface{}{"a": i})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if expect := `SELECT * FROM foo WHERE a = $1 AND b = ` + strconv.Itoa(j); q != expect {
+					t.Errorf("expected %s, got %s", expect, q)
+				}
+				db.Rebind(`SELECT ?`)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s := c.Stats()
+	if s.Len != 11 || s.Hits+s.Misses != 160 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// a db without a cache doesn't use it
+	db = db.CacheQueries(nil)
+	db.Rebind(`SELECT ?`)
+	if s2 := c.Stats(); s2 != s {
+		t.Errorf("expected the cache not to be used, got %+v", s2)
+	}
+}
@@ -1,9 +1,11 @@
 module github.com/jmoiron/sqlx
 
-go 1.10
+go 1.23
 
 require (
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.22
 )
+
+require filippo.io/edwards25519 v1.1.0 // indirect
@@ -0,0 +1,250 @@
+package sqlx
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// joinPlan maps the columns of joined rows to a struct type and to the
+// structs in its slice fields.  Columns named after a slice field, as in
+// "books.title" for a field `db:"books"`, belong to the struct type of that
+// slice.
+type joinPlan struct {
+	base     reflect.Type
+	index    []int          // the slice field in the parent struct
+	isPtr    bool           // whether the slice holds pointers
+	cols     []int          // the columns mapped to base
+	fields   [][]int        // the traversal of each of cols in base
+	types    []reflect.Type // the field type of each of cols
+	pk       []int          // the positions in cols of the pk fields
+	children []*joinPlan
+}
+
+// newJoinPlan returns the plan to scan columns into base, or nil if none of
+// the columns belong to a slice field of base.  The columns which aren't
+// mapped to any struct are returned in missing.
+func newJoinPlan(m *reflectx.Mapper, base reflect.Type, columns []string) (plan *joinPlan, missing []int, err error) {
+	cols := make([]int, len(columns))
+	for i := range cols {
+		cols[i] = i
+	}
+	plan, err = buildJoinPlan(m, base, columns, cols, &missing)
+	if err != nil || len(plan.children) == 0 {
+		return nil, nil, err
+	}
+	return plan, missing, nil
+}
+
+func buildJoinPlan(m *reflectx.Mapper, base reflect.Type, names []string, cols []int, missing *[]int) (*joinPlan, error) {
+	tm := m.TypeMap(base)
+	p := &joinPlan{base: base}
+
+	var slices []*reflectx.FieldInfo
+	for _, fi := range tm.Slices {
+		if !reflect.PtrTo(fi.Field.Type).Implements(_scannerInterface) && !isScannable(reflectx.Deref(fi.Field.Type.Elem())) {
+			slices = append(slices, fi)
+		}
+	}
+	subNames := make([][]string, len(slices))
+	subCols := make([][]int, len(slices))
+
+	var mapped []string
+Columns:
+	for i, name := range names {
+		if fi, ok := tm.Names[name]; ok {
+			mapped = append(mapped, name)
+			p.cols = append(p.cols, cols[i])
+			p.fields = append(p.fields, fi.Index)
+			p.types = append(p.types, fi.Field.Type)
+			continue
+		}
+		for s, fi := range slices {
+			if len(name) > len(fi.Path) && name[len(fi.Path)] == '.' && name[:len(fi.Path)] == fi.Path {
+				subNames[s] = append(subNames[s], name[len(fi.Path)+1:])
+				subCols[s] = append(subCols[s], cols[i])
+				continue Columns
+			}
+		}
+		*missing = append(*missing, cols[i])
+	}
+
+	for s, fi := range slices {
+		if len(subCols[s]) == 0 {
+			continue
+		}
+		child, err := buildJoinPlan(m, reflectx.Deref(fi.Field.Type.Elem()), subNames[s], subCols[s], missing)
+		if err != nil {
+			return nil, err
+		}
+		child.index = fi.Index
+		child.isPtr = fi.Field.Type.Elem().Kind() == reflect.Ptr
+		p.children = append(p.children, child)
+	}
+
+	// the pk is only needed to group the rows of the slices;  a struct with
+	// no slices of its own is told apart by it if it's there
+	for _, fi := range tm.Index {
+		if _, ok := fi.Options["pk"]; !ok || tm.Names[fi.Path] != fi {
+			continue
+		}
+		j := 0
+		for j < len(mapped) && mapped[j] != fi.Path {
+			j++
+		}
+		if j == len(mapped) {
+			if len(p.children) > 0 {
+				return nil, fmt.Errorf("missing pk column %s of %s", fi.Path, base)
+			}
+			p.pk = nil
+			break
+		}
+		p.pk = append(p.pk, j)
+	}
+	if len(p.pk) == 0 && len(p.children) > 0 {
+		return nil, fmt.Errorf("no pk field in %s to group joined rows by", base)
+	}
+	return p, nil
+}
+
+// joinNode is a struct being filled from joined rows, and the structs of its
+// slice fields, which are set once all rows are scanned.
+type joinNode struct {
+	v    reflect.Value // a pointer to the struct
+	kids [][]*joinNode
+	seen []map[interface{}]*joinNode
+}
+
+func newJoinNode(v reflect.Value, p *joinPlan) *joinNode {
+	n := &joinNode{
+		v:    v,
+		kids: make([][]*joinNode, len(p.children)),
+		seen: make([]map[interface{}]*joinNode, len(p.children)),
+	}
+	for c := range n.seen {
+		n.seen[c] = map[interface{}]*joinNode{}
+	}
+	return n
+}
+
+// add adds the struct of plan p in the scanned values to the kids of n for
+// the slice c, unless it's already there.  The values of p's columns are
+// pointers to pointers, which are nil for NULL.  A struct with a NULL pk,
+// or with only NULLs if it has no pk, isn't there at all, as for the rows of
+// an outer join.
+func (n *joinNode) add(c int, p *joinPlan, values []interface{}) {
+	held := func(j int) reflect.Value {
+		return reflect.ValueOf(values[p.cols[j]]).Elem()
+	}
+
+	var key interface{}
+	if len(p.pk) > 0 {
+		keys := make([]interface{}, len(p.pk))
+		for i, j := range p.pk {
+			h := held(j)
+			if h.IsNil() {
+				return
+			}
+			keys[i] = h.Elem().Interface()
+		}
+		if len(keys) == 1 && reflect.TypeOf(keys[0]).Comparable() {
+			key = keys[0]
+		} else {
+			key = fmt.Sprintf("%#v", keys)
+		}
+		if kid, ok := n.seen[c][key]; ok {
+			kid.addChildren(p, values)
+			return
+		}
+	} else {
+		j := 0
+		for j < len(p.cols) && held(j).IsNil() {
+			j++
+		}
+		if j == len(p.cols) {
+			return
+		}
+	}
+
+	kid := newJoinNode(reflect.New(p.base), p)
+	for j, traversal := range p.fields {
+		if h := held(j); !h.IsNil() {
+			reflectx.FieldByIndexes(kid.v.Elem(), traversal).Set(h.Elem())
+		}
+	}
+	n.kids[c] = append(n.kids[c], kid)
+	if key != nil {
+		n.seen[c][key] = kid
+	}
+	kid.addChildren(p, values)
+}
+
+func (n *joinNode) addChildren(p *joinPlan, values []interface{}) {
+	for c, child := range p.children {
+		n.add(c, child, values)
+	}
+}
+
+// fill sets the slice fields of n to its kids.  Slices with no kids are left
+// nil.
+func (n *joinNode) fill(p *joinPlan) {
+	for c, child := range p.children {
+		if len(n.kids[c]) == 0 {
+			continue
+		}
+		field := reflectx.FieldByIndexes(n.v.Elem(), child.index)
+		slice := reflect.MakeSlice(field.Type(), 0, len(n.kids[c]))
+		for _, kid := range n.kids[c] {
+			slice = reflect.Append(slice, kid.elem(child))
+		}
+		field.Set(slice)
+	}
+}
+
+// elem fills n and returns it as an element of the slice of plan p.
+func (n *joinNode) elem(p *joinPlan) reflect.Value {
+	n.fill(p)
+	if p.isPtr {
+		return n.v
+	}
+	return n.v.Elem()
+}
+
+// scanJoin scans joined rows into direct, a slice of the struct of plan,
+// grouping the rows of each struct by its pk fields.  Columns which aren't in
+// plan are discarded.
+func scanJoin(rows rowsi, plan *joinPlan, ncols int, direct reflect.Value, isPtr bool) error {
+	values := make([]interface{}, ncols)
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	var hold func(p *joinPlan)
+	hold = func(p *joinPlan) {
+		for j, t := range p.types {
+			values[p.cols[j]] = reflect.New(reflect.PtrTo(t)).Interface()
+		}
+		for _, child := range p.children {
+			hold(child)
+		}
+	}
+	hold(plan)
+
+	root := &joinPlan{children: []*joinPlan{plan}}
+	top := newJoinNode(reflect.Value{}, root)
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+		top.add(0, plan, values)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	plan.isPtr = isPtr
+	for _, n := range top.kids[0] {
+		direct.Set(reflect.Append(direct, n.elem(plan)))
+	}
+	return nil
+}
@@ -12,24 +12,36 @@ package sqlx
 //  * bindArgs, bindMapArgs, bindAnyArgs - given a list of names, return an arglist
 //
 import (
-	"bytes"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
-	"regexp"
 	"strconv"
-	"unicode"
+	"strings"
 
 	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/jmoiron/sqlx/sqllex"
 )
 
 // NamedStmt is a prepared statement that executes named queries.  Prepare it
 // how you would execute a NamedQuery, but pass in a struct or map when executing.
+// Because the bindvars of a prepared statement are fixed, slice arguments are
+// not expanded as they are by NamedQuery and NamedExec.
+//
+// Params has the name bound to each arg of the statement, in order.  For the
+// DOLLAR and AT bindtypes, a name used more than once in the query is only in
+// Params once and all of its uses share its bindvar;  see Named.
 type NamedStmt struct {
 	Params      []string
 	QueryString string
 	Stmt        *Stmt
+	// native is the names of the sql.NamedArg values bound to Params if
+	// NamedArgs was set for the driver when the statement was prepared.
+	native []string
+	// defaults has the default values of optional params.
+	defaults map[string]interface{}
+	// db is the DB the statement was prepared on, if it was.
+	db *DB
 }
 
 // Close closes the named statement.
@@ -37,10 +49,19 @@ func (n *NamedStmt) Close() error {
 	return n.Stmt.Close()
 }
 
+// bindArgs returns the args for the statement from the fields of arg.
+func (n *NamedStmt) bindArgs(arg interface{}) ([]interface{}, error) {
+	args, err := bindAnyArgs(n.Params, arg, n.Stmt.Mapper, n.defaults)
+	if err != nil || n.native == nil {
+		return args, err
+	}
+	return namedArgList(n.native, args), nil
+}
+
 // Exec executes a named statement using the struct passed.
 // Any named placeholder parameters are replaced with fields from arg.
 func (n *NamedStmt) Exec(arg interface{}) (sql.Result, error) {
-	args, err := bindAnyArgs(n.Params, arg, n.Stmt.Mapper)
+	args, err := n.bindArgs(arg)
 	if err != nil {
 		return *new(sql.Result), err
 	}
@@ -50,7 +71,7 @@ func (n *NamedStmt) Exec(arg interface{}) (sql.Result, error) {
 // Query executes a named statement using the struct argument, returning rows.
 // Any named placeholder parameters are replaced with fields from arg.
 func (n *NamedStmt) Query(arg interface{}) (*sql.Rows, error) {
-	args, err := bindAnyArgs(n.Params, arg, n.Stmt.Mapper)
+	args, err := n.bindArgs(arg)
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +83,7 @@ func (n *NamedStmt) Query(arg interface{}) (*sql.Rows, error) {
 // returns a *sqlx.Row instead.
 // Any named placeholder parameters are replaced with fields from arg.
 func (n *NamedStmt) QueryRow(arg interface{}) *Row {
-	args, err := bindAnyArgs(n.Params, arg, n.Stmt.Mapper)
+	args, err := n.bindArgs(arg)
 	if err != nil {
 		return &Row{err: err}
 	}
@@ -117,7 +138,7 @@ func (n *NamedStmt) Get(dest interface{}, arg interface{}) error {
 
 // Unsafe creates an unsafe version of the NamedStmt
 func (n *NamedStmt) Unsafe() *NamedStmt {
-	r := &NamedStmt{Params: n.Params, Stmt: n.Stmt, QueryString: n.QueryString}
+	r := &NamedStmt{Params: n.Params, Stmt: n.Stmt, QueryString: n.QueryString, native: n.native, defaults: n.defaults, db: n.db}
 	r.Stmt.unsafe = true
 	return r
 }
@@ -130,20 +151,105 @@ type namedPreparer interface {
 }
 
 func prepareNamed(p namedPreparer, query string) (*NamedStmt, error) {
-	bindType := BindType(p.DriverName())
-	q, args, err := compileNamedQuery([]byte(query), bindType)
+	n, err := compileNamedStmt(p.DriverName(), query)
+	if err != nil {
+		return nil, err
+	}
+	n.Stmt, err = Preparex(p, n.QueryString)
 	if err != nil {
 		return nil, err
 	}
-	stmt, err := Preparex(p, q)
+	n.db, _ = p.(*DB)
+	return n, nil
+}
+
+// compileNamedStmt compiles query into a NamedStmt for driverName, which is
+// ready to be prepared.
+func compileNamedStmt(driverName, query string) (*NamedStmt, error) {
+	bindType := BindType(driverName)
+	nq, err := parseNamedQuery([]byte(query), driverDialect(driverName))
 	if err != nil {
 		return nil, err
 	}
-	return &NamedStmt{
-		QueryString: q,
-		Params:      args,
-		Stmt:        stmt,
-	}, nil
+	n := &NamedStmt{Params: nq.params(bindType), defaults: nq.defaults}
+	if !NamedArgs(driverName) {
+		n.QueryString = nq.bind(bindType, nil)
+		return n, nil
+	}
+	n.Params = nq.unique
+	if n.native, err = nq.nativeNames(nil); err != nil {
+		return nil, err
+	}
+	n.QueryString = nq.bindNative(bindType, nil)
+	return n, nil
+}
+
+// ValidateNamed compiles query and checks that each of its params can be bound
+// from a value of type t, which is usually a struct or a pointer to a struct,
+// without running anything.  Names are found as they are when binding, using
+// the default mapper, and dotted names are followed through nested structs.
+// Keys of maps and values held in interfaces can't be known until the query is
+// run, so names which reach them are assumed to be there, as are optional
+// params.  The error lists every name which could not be found.  A nil t, like
+// reflect.TypeOf of a nil interface, is an error.
+func ValidateNamed(query string, t reflect.Type) error {
+	return validateNamed(mapper(), sqllex.Generic, query, t)
+}
+
+// validateNamed is ValidateNamed for the mapper m, lexing query with d.
+func validateNamed(m *reflectx.Mapper, d sqllex.Dialect, query string, t reflect.Type) error {
+	if t == nil {
+		return errors.New("cannot validate a named query against a nil type")
+	}
+	nq, err := parseNamedQuery([]byte(query), d)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, name := range nq.unique {
+		if _, optional := nq.defaults[name]; !optional && !typeHasPath(t, name, m) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("could not find names %s in %s", strings.Join(missing, ", "), t)
+	}
+	return nil
+}
+
+// typeHasPath returns whether the dotted name could be found by lookupPath in
+// a value of type t.  It's true for any name which reaches a map with string
+// keys or an interface, since what they hold is only known at runtime.
+func typeHasPath(t reflect.Type, name string, m *reflectx.Mapper) bool {
+	parts := strings.Split(name, ".")
+	for i := 0; i < len(parts); {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Interface:
+			return true
+		case reflect.Map:
+			return t.Key().Kind() == reflect.String
+		case reflect.Struct:
+			// the mapper has the dotted names of fields of nested structs
+			names := m.TypeMap(t).Names
+			k := len(parts)
+			for ; k > i; k-- {
+				if fi, ok := names[strings.Join(parts[i:k], ".")]; ok {
+					t = fi.Field.Type
+					break
+				}
+			}
+			if k == i {
+				return false
+			}
+			i = k
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // convertMapStringInterface attempts to convert v to map[string]interface{}.
@@ -160,17 +266,91 @@ func convertMapStringInterface(v interface{}) (map[string]interface{}, bool) {
 
 }
 
-func bindAnyArgs(names []string, arg interface{}, m *reflectx.Mapper) ([]interface{}, error) {
+func bindAnyArgs(names []string, arg interface{}, m *reflectx.Mapper, defaults map[string]interface{}) ([]interface{}, error) {
+	if merged, ok := arg.(MergedArgs); ok {
+		return merged.bindArgs(names, m, defaults)
+	}
 	if maparg, ok := convertMapStringInterface(arg); ok {
-		return bindMapArgs(names, maparg)
+		return bindMapArgs(names, maparg, m, defaults)
 	}
-	return bindArgs(names, arg, m)
+	return bindArgs(names, arg, m, defaults)
+}
+
+// MergedArgs is an arg for a named query whose params are looked up in several
+// structs and maps.  It can be used anywhere a single struct or map can, like
+// Named, NamedExec, NamedQuery and NamedStmt.Exec, or as an element of a batch.
+type MergedArgs struct {
+	sources []interface{}
+}
+
+// MergeArgs returns a MergedArgs which looks up each param in the sources in
+// order, so that a name found in an earlier source shadows the same name in any
+// later one.  Put the values which should win first, for instance:
+//
+//	arg := sqlx.MergeArgs(map[string]interface{}{"tenant_id": tenant}, &user)
+func MergeArgs(sources ...interface{}) MergedArgs {
+	return MergedArgs{sources: sources}
+}
+
+// bindArgs returns the values for names from the sources of a.
+func (a MergedArgs) bindArgs(names []string, m *reflectx.Mapper, defaults map[string]interface{}) ([]interface{}, error) {
+	arglist := make([]interface{}, len(names))
+	found := make([]bool, len(names))
+	for _, src := range a.sources {
+		if maparg, ok := convertMapStringInterface(src); ok {
+			for i, name := range names {
+				if found[i] {
+					continue
+				}
+				val, ok := maparg[name]
+				if !ok && strings.IndexByte(name, '.') != -1 {
+					val, ok, _ = lookupPath(reflect.ValueOf(maparg), name, m)
+				}
+				arglist[i], found[i] = val, ok
+			}
+			continue
+		}
+
+		v := reflect.ValueOf(src)
+		for v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if !v.IsValid() || v.Kind() != reflect.Struct {
+			continue
+		}
+		for i, t := range m.TraversalsByName(v.Type(), names) {
+			switch {
+			case found[i]:
+			case len(t) > 0:
+				arglist[i], found[i] = reflectx.FieldByIndexesReadOnly(v, t).Interface(), true
+			case strings.IndexByte(names[i], '.') != -1:
+				arglist[i], found[i], _ = lookupPath(v, names[i], m)
+			}
+		}
+	}
+
+	for i, ok := range found {
+		if def, optional := defaults[names[i]]; !ok && optional {
+			arglist[i] = def
+			continue
+		}
+		if !ok {
+			// only the types of the sources are listed, as their values may
+			// hold anything and errors end up in logs
+			searched := make([]string, len(a.sources))
+			for j, src := range a.sources {
+				searched[j] = fmt.Sprintf("%d (%T)", j, src)
+			}
+			return arglist[:0], fmt.Errorf("could not find name %s in any of the merged args %s", names[i], strings.Join(searched, ", "))
+		}
+	}
+	return arglist, nil
 }
 
 // private interface to generate a list of interfaces from a given struct
 // type, given a list of names to pull out of the struct.  Used by public
 // BindStruct interface.
-func bindArgs(names []string, arg interface{}, m *reflectx.Mapper) ([]interface{}, error) {
+func bindArgs(names []string, arg interface{}, m *reflectx.Mapper, defaults map[string]interface{}) ([]interface{}, error) {
 	arglist := make([]interface{}, 0, len(names))
 
 	// grab the indirected value of arg
@@ -181,7 +361,20 @@ func bindArgs(names []string, arg interface{}, m *reflectx.Mapper) ([]interface{
 
 	err := m.TraversalsByNameFunc(v.Type(), names, func(i int, t []int) error {
 		if len(t) == 0 {
-			return fmt.Errorf("could not find name %s in %#v", names[i], arg)
+			var missing string
+			if strings.IndexByte(names[i], '.') != -1 {
+				val, ok, why := lookupPath(v, names[i], m)
+				if ok {
+					arglist = append(arglist, val)
+					return nil
+				}
+				missing = ": " + why
+			}
+			if def, ok := defaults[names[i]]; ok {
+				arglist = append(arglist, def)
+				return nil
+			}
+			return fmt.Errorf("could not find name %s in %#v%s", names[i], arg, missing)
 		}
 
 		val := reflectx.FieldByIndexesReadOnly(v, t)
@@ -193,216 +386,758 @@ func bindArgs(names []string, arg interface{}, m *reflectx.Mapper) ([]interface{
 	return arglist, err
 }
 
-// like bindArgs, but for maps.
-func bindMapArgs(names []string, arg map[string]interface{}) ([]interface{}, error) {
+// like bindArgs, but for maps.  A name which isn't a key of the map is looked
+// up as a path with lookupPath.
+func bindMapArgs(names []string, arg map[string]interface{}, m *reflectx.Mapper, defaults map[string]interface{}) ([]interface{}, error) {
 	arglist := make([]interface{}, 0, len(names))
 
 	for _, name := range names {
 		val, ok := arg[name]
+		var missing string
+		if !ok && strings.IndexByte(name, '.') != -1 {
+			val, ok, missing = lookupPath(reflect.ValueOf(arg), name, m)
+			missing = ": " + missing
+		}
+		if !ok {
+			val, ok = defaults[name]
+		}
 		if !ok {
-			return arglist, fmt.Errorf("could not find name %s in %#v", name, arg)
+			return arglist, fmt.Errorf("could not find name %s in %#v%s", name, arg, missing)
 		}
 		arglist = append(arglist, val)
 	}
 	return arglist, nil
 }
 
+// lookupPath returns the value for the dotted name in v, following the parts of
+// the name through any mix of structs, maps with string keys, and pointers and
+// interfaces holding them.  The rest of a name can also be a key of a map, so
+// `:a.b.c` finds m["b.c"] in a map in field a.  If the value isn't found, why
+// says which part of the path is missing.
+func lookupPath(v reflect.Value, name string, m *reflectx.Mapper) (val interface{}, ok bool, why string) {
+	parts := strings.Split(name, ".")
+	at := func(i int) string {
+		if i == 0 {
+			return "the arg"
+		}
+		return strings.Join(parts[:i], ".")
+	}
+
+	for i := 0; i < len(parts); {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil, false, at(i) + " is nil"
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false, at(i) + " is not a map with string keys"
+			}
+			if v.IsNil() {
+				return nil, false, at(i) + " is nil"
+			}
+			var e reflect.Value
+			for k := len(parts); k > i && !e.IsValid(); k-- {
+				key := reflect.ValueOf(strings.Join(parts[i:k], ".")).Convert(v.Type().Key())
+				if e = v.MapIndex(key); e.IsValid() {
+					v, i = e, k
+				}
+			}
+			if !e.IsValid() {
+				return nil, false, at(i) + " has no key " + parts[i]
+			}
+		case reflect.Struct:
+			t := m.TraversalsByName(v.Type(), parts[i:i+1])[0]
+			if len(t) == 0 {
+				return nil, false, at(i) + " has no field " + parts[i]
+			}
+			for _, j := range t {
+				for v.Kind() == reflect.Ptr {
+					if v.IsNil() {
+						return nil, false, at(i+1) + " is in a nil embedded struct"
+					}
+					v = v.Elem()
+				}
+				v = v.Field(j)
+			}
+			i++
+		default:
+			return nil, false, at(i) + " is a " + v.Kind().String() + ", not a struct or map"
+		}
+	}
+	return v.Interface(), true, ""
+}
+
 // bindStruct binds a named parameter query with fields from a struct argument.
 // The rules for binding field names to parameter names follow the same
 // conventions as for StructScan, including obeying the `db` struct tags.
 func bindStruct(bindType int, query string, arg interface{}, m *reflectx.Mapper) (string, []interface{}, error) {
-	bound, names, err := compileNamedQuery([]byte(query), bindType)
+	nq, err := parseNamedQuery([]byte(query), dialectFor(bindType))
 	if err != nil {
 		return "", []interface{}{}, err
 	}
+	return nq.bindStruct(bindType, arg, m)
+}
 
-	arglist, err := bindAnyArgs(names, arg, m)
+// bindStruct binds the query parsed for bindType with fields from arg.
+func (nq *namedQuery) bindStruct(bindType int, arg interface{}, m *reflectx.Mapper) (string, []interface{}, error) {
+	arglist, err := bindAnyArgs(nq.params(bindType), arg, m, nq.defaults)
 	if err != nil {
 		return "", []interface{}{}, err
 	}
 
-	return bound, arglist, nil
+	return nq.bindArgs(bindType, arglist)
 }
 
-var valuesReg = regexp.MustCompile(`\)\s*(?i)VALUES\s*\(`)
-
-func findMatchingClosingBracketIndex(s string) int {
-	count := 0
-	for i, ch := range s {
-		if ch == '(' {
-			count++
+// splitBatch finds the part of an INSERT query which is repeated for each row
+// of a batch, which is the tuple after VALUES.  Only the top level of the query
+// is searched, so that VALUES in subqueries and CTEs is not matched, and
+// nothing is searched from a trailing ON CONFLICT, ON DUPLICATE KEY or
+// RETURNING clause on.  It returns the position of that part of the query and
+// the separator to put between its repeats.  It is not ok if there is no such
+// part.  An INSERT ... SELECT is not split, since joining its rows with UNION
+// ALL would make postgres resolve their params as text.
+func splitBatch(query string, d sqllex.Dialect) (start, end int, sep string, ok bool) {
+	var toks []sqllex.Token
+	var depths []int
+	depth := 0
+	for _, t := range sqllex.Tokenize(query, d) {
+		if isSpaceOrComment(t) {
+			continue
 		}
-		if ch == ')' {
-			count--
-			if count == 0 {
-				return i
-			}
+		if t.Text == ")" {
+			depth--
+		}
+		toks = append(toks, t)
+		depths = append(depths, depth)
+		if t.Text == "(" {
+			depth++
 		}
 	}
-	return 0
-}
 
-func fixBound(bound string, loop int) string {
-	loc := valuesReg.FindStringIndex(bound)
-	// defensive guard when "VALUES (...)" not found
-	if len(loc) < 2 {
-		return bound
+	isWord := func(i int, word string) bool {
+		return i < len(toks) && toks[i].Kind == sqllex.Word && strings.EqualFold(toks[i].Text, word)
 	}
 
-	openingBracketIndex := loc[1] - 1
-	index := findMatchingClosingBracketIndex(bound[openingBracketIndex:])
-	// defensive guard. must have closing bracket
-	if index == 0 {
-		return bound
+	tail := len(toks)
+	for i := range toks {
+		if depths[i] == 0 && (isWord(i, "RETURNING") || isWord(i, "ON") && (isWord(i+1, "CONFLICT") || isWord(i+1, "DUPLICATE"))) {
+			tail = i
+			break
+		}
+	}
+
+	for i := 0; i < tail; i++ {
+		if depths[i] == 0 && isWord(i, "VALUES") && i+1 < tail && toks[i+1].Text == "(" {
+			for j := i + 2; j < tail; j++ {
+				if toks[j].Text == ")" && depths[j] == 0 {
+					return toks[i+1].Pos, toks[j].Pos + 1, ",", true
+				}
+			}
+			return 0, 0, "", false
+		}
 	}
-	closingBracketIndex := openingBracketIndex + index + 1
+	return 0, 0, "", false
+}
 
-	var buffer bytes.Buffer
+// batchQuery is a named query for a batch insert.  The row is repeated for
+// each element of the batch, separated by sep, and the params in the head and
+// tail around it are bound once to the first element.  If the query has no
+// row to repeat, all of it is in row and sep is empty.
+type batchQuery struct {
+	head, row, tail *namedQuery
+	sep             string
+}
 
-	buffer.WriteString(bound[0:closingBracketIndex])
-	for i := 0; i < loop-1; i++ {
-		buffer.WriteString(",")
-		buffer.WriteString(bound[openingBracketIndex:closingBracketIndex])
+// parseBatchQuery parses a named query for a batch insert using the lexical
+// rules of d.
+func parseBatchQuery(qs string, d sqllex.Dialect) (*batchQuery, error) {
+	d = lexDialect(qs, d)
+	start, end, sep, ok := splitBatch(qs, d)
+	if !ok {
+		start, end = 0, len(qs)
+	}
+	parts := [3]*namedQuery{}
+	for i, part := range [3]string{qs[:start], qs[start:end], qs[end:]} {
+		nq, err := parseNamedQuery([]byte(part), d)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = nq
 	}
-	buffer.WriteString(bound[closingBracketIndex:])
-	return buffer.String()
+	return &batchQuery{head: parts[0], row: parts[1], tail: parts[2], sep: sep}, nil
 }
 
 // bindArray binds a named parameter query with fields from an array or slice of
 // structs argument.
 func bindArray(bindType int, query string, arg interface{}, m *reflectx.Mapper) (string, []interface{}, error) {
-	// do the initial binding with QUESTION;  if bindType is not question,
-	// we can rebind it at the end.
-	bound, names, err := compileNamedQuery([]byte(query), QUESTION)
+	bq, err := parseBatchQuery(query, dialectFor(bindType))
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+	return bq.bindArray(bindType, arg, m)
+}
+
+// bindArray binds the batch query with fields from each element of arg.  Like
+// In, slices in the elements for params in `IN (...)` lists are expanded into
+// lists of bindvars.  The bindvars of the head, each row and the tail are
+// numbered on from those before them.
+func (bq *batchQuery) bindArray(bindType int, arg interface{}, m *reflectx.Mapper) (string, []interface{}, error) {
+	qs, args, err := bq.bindChunks(bindType, arg, m, 0)
 	if err != nil {
 		return "", []interface{}{}, err
 	}
+	return qs[0], args[0], nil
+}
+
+// boundPart is a part of a batch query bound to an element of the batch, with
+// its slices expanded.  raw has the args before they were expanded.
+type boundPart struct {
+	counts []int
+	args   []interface{}
+	raw    []interface{}
+}
+
+// bindPart binds the part of a batch query parsed into nq to elem.
+func (nq *namedQuery) bindPart(bindType int, elem interface{}, m *reflectx.Mapper) (boundPart, error) {
+	raw, err := bindAnyArgs(nq.params(bindType), elem, m, nq.defaults)
+	if err != nil {
+		return boundPart{}, err
+	}
+	counts, args, err := expandSliceArgs(raw, nq.expands(bindType))
+	if err != nil {
+		return boundPart{}, err
+	}
+	return boundPart{counts: counts, args: args, raw: raw}, nil
+}
+
+// checkOnce returns an error if the params of the part of a batch query parsed
+// into nq, which is bound once to the first element as p, would be bound to
+// different values for elem, the ith element.
+func (nq *namedQuery) checkOnce(bindType int, p boundPart, i int, elem interface{}, m *reflectx.Mapper) error {
+	if len(p.raw) == 0 {
+		return nil
+	}
+	raw, err := bindAnyArgs(nq.params(bindType), elem, m, nq.defaults)
+	if err != nil {
+		return err
+	}
+	for j, name := range nq.params(bindType) {
+		if !reflect.DeepEqual(raw[j], p.raw[j]) {
+			return fmt.Errorf("param %s is outside of the VALUES list and bound once, but batch element %d has a different value for it than element 0", name, i)
+		}
+	}
+	return nil
+}
+
+// bindChunks is bindArray, splitting the rows into chunks so that the query for
+// each has at most limit bindvars, or not at all if limit is 0.  The head and
+// tail of every chunk are bound to the first element of arg, and it is an error
+// for any other element to have different values for their params.
+func (bq *batchQuery) bindChunks(bindType int, arg interface{}, m *reflectx.Mapper, limit int) ([]string, [][]interface{}, error) {
 	arrayValue := reflect.ValueOf(arg)
 	arrayLen := arrayValue.Len()
 	if arrayLen == 0 {
-		return "", []interface{}{}, fmt.Errorf("length of array is 0: %#v", arg)
+		return nil, nil, fmt.Errorf("length of array is 0: %#v", arg)
 	}
-	var arglist = make([]interface{}, 0, len(names)*arrayLen)
-	for i := 0; i < arrayLen; i++ {
-		elemArglist, err := bindAnyArgs(names, arrayValue.Index(i).Interface(), m)
-		if err != nil {
-			return "", []interface{}{}, err
-		}
-		arglist = append(arglist, elemArglist...)
+	if arrayLen > 1 && bq.sep == "" {
+		return nil, nil, fmt.Errorf("cannot bind %d rows to a query without a VALUES list", arrayLen)
+	}
+	first := arrayValue.Index(0).Interface()
+
+	head, err := bq.head.bindPart(bindType, first, m)
+	if err != nil {
+		return nil, nil, err
 	}
-	if arrayLen > 1 {
-		bound = fixBound(bound, arrayLen)
+	tail, err := bq.tail.bindPart(bindType, first, m)
+	if err != nil {
+		return nil, nil, err
 	}
-	// adjust binding type if we weren't on question
-	if bindType != QUESTION {
-		bound = Rebind(bindType, bound)
+	rows := make([]boundPart, arrayLen)
+	for i := range rows {
+		elem := arrayValue.Index(i).Interface()
+		if rows[i], err = bq.row.bindPart(bindType, elem, m); err != nil {
+			return nil, nil, err
+		}
+		if i == 0 {
+			continue
+		}
+		if err := bq.head.checkOnce(bindType, head, i, elem, m); err != nil {
+			return nil, nil, err
+		}
+		if err := bq.tail.checkOnce(bindType, tail, i, elem, m); err != nil {
+			return nil, nil, err
+		}
 	}
-	return bound, arglist, nil
+
+	var qs []string
+	var arglists [][]interface{}
+	once := len(head.args) + len(tail.args)
+	for start := 0; start < arrayLen; {
+		n := once + len(rows[start].args)
+		if limit > 0 && n > limit {
+			return nil, nil, fmt.Errorf("query has %d bindvars, which is more than the limit of %d", n, limit)
+		}
+		end := start + 1
+		for ; end < arrayLen; end++ {
+			if limit > 0 && n+len(rows[end].args) > limit {
+				break
+			}
+			n += len(rows[end].args)
+		}
+
+		var b strings.Builder
+		arglist := make([]interface{}, 0, n)
+		ordinal := 1
+		write := func(nq *namedQuery, p boundPart) {
+			var q string
+			q, ordinal = nq.bindFrom(bindType, p.counts, ordinal)
+			b.WriteString(q)
+			arglist = append(arglist, p.args...)
+		}
+		write(bq.head, head)
+		for i := start; i < end; i++ {
+			if i > start {
+				b.WriteString(bq.sep)
+			}
+			write(bq.row, rows[i])
+		}
+		write(bq.tail, tail)
+		qs = append(qs, b.String())
+		arglists = append(arglists, arglist)
+		start = end
+	}
+	return qs, arglists, nil
 }
 
 // bindMap binds a named parameter query with a map of arguments.
 func bindMap(bindType int, query string, args map[string]interface{}) (string, []interface{}, error) {
-	bound, names, err := compileNamedQuery([]byte(query), bindType)
+	nq, err := parseNamedQuery([]byte(query), dialectFor(bindType))
 	if err != nil {
 		return "", []interface{}{}, err
 	}
+	return nq.bindMap(bindType, args, mapper())
+}
+
+// bindMap binds the query parsed for bindType with a map of arguments.
+func (nq *namedQuery) bindMap(bindType int, args map[string]interface{}, m *reflectx.Mapper) (string, []interface{}, error) {
+	arglist, err := bindMapArgs(nq.params(bindType), args, m, nq.defaults)
+	if err != nil {
+		return "", arglist, err
+	}
 
-	arglist, err := bindMapArgs(names, args)
-	return bound, arglist, err
+	return nq.bindArgs(bindType, arglist)
 }
 
 // -- Compilation of Named Queries
 
-// Allow digits and letters in bind params;  additionally runes are
-// checked against underscores, meaning that bind params can have be
-// alphanumeric with underscores.  Mind the difference between unicode
-// digits and numbers, where '5' is a digit but '五' is not.
-var allowedBindRunes = []*unicode.RangeTable{unicode.Letter, unicode.Digit}
-
-// FIXME: this function isn't safe for unicode named params, as a failing test
-// can testify.  This is not a regression but a failure of the original code
-// as well.  It should be modified to range over runes in a string rather than
-// bytes, even though this is less convenient and slower.  Hopefully the
-// addition of the prepared NamedStmt (which will only do this once) will make
-// up for the slightly slower ad-hoc NamedExec/NamedQuery.
-
-// compile a NamedQuery into an unbound query (using the '?' bindvar) and
-// a list of names.
-func compileNamedQuery(qs []byte, bindType int) (query string, names []string, err error) {
-	names = make([]string, 0, 10)
-	rebound := make([]byte, 0, len(qs))
-
-	inName := false
-	last := len(qs) - 1
-	currentVar := 1
-	name := make([]byte, 0, 10)
-
-	for i, b := range qs {
-		// a ':' while we're in a name is an error
-		if b == ':' {
-			// if this is the second ':' in a '::' escape sequence, append a ':'
-			if inName && i > 0 && qs[i-1] == ':' {
-				rebound = append(rebound, ':')
-				inName = false
-				continue
-			} else if inName {
-				err = errors.New("unexpected `:` while reading named param at " + strconv.Itoa(i))
-				return query, names, err
+// namedQuery is a named query split into its params and the text around them,
+// so that it can be bound to any bindtype.  There is always one more element
+// in text than in names;  text[i] is the text preceding names[i].  unique is
+// names without repeats, and slots[i] is the index of names[i] in unique.
+// defaults has the default value of each optional name.
+type namedQuery struct {
+	text []string
+	// unescaped is text with each `??` unescaped to `?`, or nil if the query
+	// has none
+	unescaped []string
+	names     []string
+	unique    []string
+	slots     []int
+	defaults  map[string]interface{}
+	// inList is whether each of names is the only item of an `IN (...)`
+	// list, and uniqueInList whether each of unique always is
+	inList       []bool
+	uniqueInList []bool
+	// args is the names bound to args for bindtypes which reuse ordinals, and
+	// argSlots[i] is the index of names[i] in args.  A name has one arg for
+	// its uses in IN lists and another for its other uses, so that a slice
+	// is expanded for the former and bound as it is for the latter.
+	args      []string
+	argSlots  []int
+	argInList []bool
+}
+
+// parseNamedQuery parses a named query using the lexical rules of d.
+// Named params are letters, digits, underscores and periods following a `:`;
+// `::` is an escape for a literal `:`, and `:=` is left as is.  Params inside
+// string literals, quoted identifiers, comments and dollar-quoted strings are
+// not parsed.  For compatibility with queries written before that was so, `::`
+// is still unescaped in string literals and quoted identifiers, but comments
+// and dollar-quoted strings like function bodies are left exactly as they are.
+// An unterminated string literal, quoted identifier or comment is an error.
+// As in Rebind, `??` is an escape for a literal `?`, which is unescaped when
+// binding for any bindtype but QUESTION.
+//
+// A param written `:name?` is optional and is bound to NULL if its name is not
+// found in the arg, and one written `:{name=default}` is bound to the default,
+// which is a 'string', a number, true, false or NULL.  `:{name}` is the same
+// as `:name`.  If a name is used more than once, it is optional if any of its
+// params are, and they can't have different defaults.
+func parseNamedQuery(qs []byte, d sqllex.Dialect) (*namedQuery, error) {
+	nq := &namedQuery{names: make([]string, 0, 10)}
+	text := make([]byte, 0, len(qs))
+	var prev sqllex.Token
+
+	// the part of text and offset in it of each escaped `??`
+	var escapes [][2]int
+
+	// the last three tokens which weren't whitespace or comments, most
+	// recent first, used to recognize `IN (:name)` lists
+	var recent [3]sqllex.Token
+
+	l := sqllex.New(string(qs), lexDialect(string(qs), d))
+	for t := l.Next(); t.Kind != sqllex.EOF; prev, t = t, l.Next() {
+		if !isSpaceOrComment(t) {
+			if t.Kind == sqllex.NamedParam {
+				peek := *l
+				_, _, _, ok := inList(&peek, recent)
+				nq.inList = append(nq.inList, ok)
 			}
-			inName = true
-			name = []byte{}
-		} else if inName && i > 0 && b == '=' && len(name) == 0 {
-			rebound = append(rebound, ':', '=')
-			inName = false
-			continue
-			// if we're in a name, and this is an allowed character, continue
-		} else if inName && (unicode.IsOneOf(allowedBindRunes, rune(b)) || b == '_' || b == '.') && i != last {
-			// append the byte to the name if we are in a name and not on the last byte
-			name = append(name, b)
-			// if we're in a name and it's not an allowed character, the name is done
-		} else if inName {
-			inName = false
-			// if this is the final byte of the string and it is part of the name, then
-			// make sure to add it to the name
-			if i == last && unicode.IsOneOf(allowedBindRunes, rune(b)) {
-				name = append(name, b)
+			recent[2], recent[1], recent[0] = recent[1], recent[0], t
+		}
+		switch {
+		case t.Kind == sqllex.NamedParam || t.Kind == sqllex.DoubleColon:
+			// a ':' directly following a name is an error, unless the end
+			// of the name is marked by a `?` or a brace
+			if prev.Kind == sqllex.NamedParam && !strings.HasSuffix(prev.Text, "?") && !strings.HasSuffix(prev.Text, "}") {
+				return nil, errors.New("unexpected `:` while reading named param at " + strconv.Itoa(t.Pos))
 			}
-			// add the string representation to the names list
-			names = append(names, string(name))
-			// add a proper bindvar for the bindType
-			switch bindType {
-			// oracle only supports named type bind vars even for positional
-			case NAMED:
-				rebound = append(rebound, ':')
-				rebound = append(rebound, name...)
-			case QUESTION, UNKNOWN:
-				rebound = append(rebound, '?')
-			case DOLLAR:
-				rebound = append(rebound, '$')
-				for _, b := range strconv.Itoa(currentVar) {
-					rebound = append(rebound, byte(b))
-				}
-				currentVar++
-			case AT:
-				rebound = append(rebound, '@', 'p')
-				for _, b := range strconv.Itoa(currentVar) {
-					rebound = append(rebound, byte(b))
+			if t.Kind == sqllex.DoubleColon {
+				text = append(text, ':')
+				continue
+			}
+			if t.Optional() {
+				if err := nq.setDefault(t); err != nil {
+					return nil, err
 				}
+			}
+			nq.text = append(nq.text, string(text))
+			nq.names = append(nq.names, t.Name())
+			text = text[:0]
+		case t.Kind == sqllex.String || t.Kind == sqllex.QuotedIdent:
+			text = append(text, strings.Replace(t.Text, "::", ":", -1)...)
+		case t.Kind == sqllex.EscapedPlaceholder:
+			escapes = append(escapes, [2]int{len(nq.text), len(text)})
+			text = append(text, t.Text...)
+		default:
+			text = append(text, t.Text...)
+		}
+	}
+	if err := l.Err(); err != nil {
+		return nil, err
+	}
+	nq.text = append(nq.text, string(text))
+	if len(escapes) > 0 {
+		nq.unescaped = append([]string(nil), nq.text...)
+		for i := len(escapes) - 1; i >= 0; i-- {
+			part, at := escapes[i][0], escapes[i][1]
+			nq.unescaped[part] = nq.unescaped[part][:at] + nq.unescaped[part][at+1:]
+		}
+	}
+
+	nq.unique = make([]string, 0, len(nq.names))
+	nq.slots = make([]int, len(nq.names))
+	seen := make(map[string]int, len(nq.names))
+	for i, name := range nq.names {
+		slot, ok := seen[name]
+		if !ok {
+			slot = len(nq.unique)
+			seen[name] = slot
+			nq.unique = append(nq.unique, name)
+			nq.uniqueInList = append(nq.uniqueInList, true)
+		}
+		nq.slots[i] = slot
+		nq.uniqueInList[slot] = nq.uniqueInList[slot] && nq.inList[i]
+	}
+
+	type argKey struct {
+		name   string
+		inList bool
+	}
+	nq.args = make([]string, 0, len(nq.names))
+	nq.argSlots = make([]int, len(nq.names))
+	seenArgs := make(map[argKey]int, len(nq.names))
+	for i, name := range nq.names {
+		key := argKey{name, nq.inList[i]}
+		slot, ok := seenArgs[key]
+		if !ok {
+			slot = len(nq.args)
+			seenArgs[key] = slot
+			nq.args = append(nq.args, name)
+			nq.argInList = append(nq.argInList, key.inList)
+		}
+		nq.argSlots[i] = slot
+	}
+
+	return nq, nil
+}
+
+// setDefault sets the default for the optional param t.
+func (nq *namedQuery) setDefault(t sqllex.Token) error {
+	def, err := parseDefault(t.Default())
+	if err != nil {
+		return fmt.Errorf("invalid default for named param %s at %d: %v", t.Name(), t.Pos, err)
+	}
+	if nq.defaults == nil {
+		nq.defaults = make(map[string]interface{})
+	}
+	if prev, ok := nq.defaults[t.Name()]; ok && prev != def {
+		return fmt.Errorf("conflicting defaults for named param %s at %d", t.Name(), t.Pos)
+	}
+	nq.defaults[t.Name()] = def
+	return nil
+}
+
+// parseDefault returns the value of the default of an optional param, which
+// is nil if it has no default.
+func parseDefault(lit string) (interface{}, error) {
+	switch {
+	case lit == "" || strings.EqualFold(lit, "null"):
+		return nil, nil
+	case strings.EqualFold(lit, "true"):
+		return true, nil
+	case strings.EqualFold(lit, "false"):
+		return false, nil
+	case lit[0] == '\'':
+		if len(lit) < 2 || lit[len(lit)-1] != '\'' {
+			return nil, errors.New("unterminated string " + lit)
+		}
+		return strings.Replace(lit[1:len(lit)-1], "''", "'", -1), nil
+	}
+	if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(lit, 64); err == nil {
+		return f, nil
+	}
+	return nil, errors.New("expected a string, number, true, false or NULL, got " + lit)
+}
+
+// texts returns the text around the params of the query for bindType, which
+// has `??` unescaped unless bindType is QUESTION, whose bindvars it escapes.
+func (nq *namedQuery) texts(bindType int) []string {
+	if nq.unescaped == nil || bindType == QUESTION || bindType == UNKNOWN {
+		return nq.text
+	}
+	return nq.unescaped
+}
+
+// reusesOrdinals returns whether bindvars of bindType are numbered such that a
+// repeated param can refer back to the bindvar of its first use.
+func reusesOrdinals(bindType int) bool {
+	return bindType == DOLLAR || bindType == AT
+}
+
+// params returns the names which are bound to the args of the query for
+// bindType, in order.  For bindtypes with numbered bindvars, a name used more
+// than once in the query is only bound once, or twice if it is used both in
+// and out of `IN (...)` lists.
+func (nq *namedQuery) params(bindType int) []string {
+	if reusesOrdinals(bindType) {
+		return nq.args
+	}
+	return nq.names
+}
+
+// expands returns whether each of the params of the query for bindType can
+// have a slice expanded into a list of bindvars, which is when it is the only
+// item of an `IN (...)` list.  Other slices are bound as they are, eg. for
+// array columns.
+func (nq *namedQuery) expands(bindType int) []bool {
+	if reusesOrdinals(bindType) {
+		return nq.argInList
+	}
+	return nq.inList
+}
+
+// bind returns the query with its params replaced by bindvars for bindType.
+// counts is nil or has an element for each of the params of the query for
+// bindType;  if counts[i] is non-zero, the ith param is replaced by a list of
+// counts[i] bindvars, which is how slice arguments are expanded.  For DOLLAR
+// and AT, a repeated param reuses the bindvars of its first use, except that
+// its uses in IN lists and elsewhere have separate bindvars.
+func (nq *namedQuery) bind(bindType int, counts []int) string {
+	q, _ := nq.bindFrom(bindType, counts, 1)
+	return q
+}
+
+// bindFrom is bind, numbering the bindvars from ordinal rather than 1.  It
+// also returns the ordinal after the last bindvar.
+func (nq *namedQuery) bindFrom(bindType int, counts []int, ordinal int) (string, int) {
+	text := nq.texts(bindType)
+	size := len(nq.names) * 4
+	for _, t := range text {
+		size += len(t)
+	}
+	rebound := make([]byte, 0, size)
+
+	reuse := reusesOrdinals(bindType)
+	var first []int
+	if reuse {
+		first = make([]int, len(nq.args))
+	}
+
+	currentVar := ordinal
+	for i, name := range nq.names {
+		rebound = append(rebound, text[i]...)
+		p := i
+		if reuse {
+			p = nq.argSlots[i]
+		}
+		n := 0
+		if counts != nil {
+			n = counts[p]
+		}
+		ordinal = currentVar
+		if reuse && first[p] != 0 {
+			ordinal = first[p]
+		} else {
+			if reuse {
+				first[p] = currentVar
+			}
+			if n == 0 {
 				currentVar++
+			} else {
+				currentVar += n
 			}
-			// add this byte to string unless it was not part of the name
-			if i != last {
-				rebound = append(rebound, b)
-			} else if !unicode.IsOneOf(allowedBindRunes, rune(b)) {
-				rebound = append(rebound, b)
+		}
+		if n == 0 {
+			rebound = appendBindvar(rebound, bindType, ordinal, name)
+			continue
+		}
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				rebound = append(rebound, ',', ' ')
 			}
-		} else {
-			// this is a normal byte and should just go onto the rebound query
-			rebound = append(rebound, b)
+			rebound = appendBindvar(rebound, bindType, ordinal+j, "")
 		}
 	}
+	return string(append(rebound, text[len(nq.names)]...)), currentVar
+}
+
+// bindArgs binds the query for bindType with arglist, which is the list of
+// values for its params.  Slices in arglist for params in `IN (...)` lists are
+// expanded into lists of bindvars in the same way as they are by In.
+func (nq *namedQuery) bindArgs(bindType int, arglist []interface{}) (string, []interface{}, error) {
+	counts, arglist, err := expandSliceArgs(arglist, nq.expands(bindType))
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+	return nq.bind(bindType, counts), arglist, nil
+}
+
+// nativeName returns the name of the sql.NamedArg for a named param.  Periods
+// can't be used in bindvar names, so they are replaced by underscores.
+func nativeName(name string) string {
+	return strings.Replace(name, ".", "_", -1)
+}
 
-	return string(rebound), names, err
+// nativeNames returns the names of the sql.NamedArg values bound to the
+// params in nq.unique, with counts as for bindNative.  Since periods are
+// replaced, different params like `:a.b` and `:a_b` can have the same name,
+// which is an error, as is a param named like an element of an expanded slice.
+func (nq *namedQuery) nativeNames(counts []int) ([]string, error) {
+	names := make([]string, 0, len(nq.unique))
+	params := make(map[string]string, len(nq.unique))
+	add := func(native, param string) error {
+		if other, ok := params[native]; ok {
+			return fmt.Errorf("named params %s and %s are both bound to the sql.NamedArg %s", other, param, native)
+		}
+		params[native] = param
+		names = append(names, native)
+		return nil
+	}
+	for p, name := range nq.unique {
+		native := nativeName(name)
+		if counts == nil || counts[p] == 0 {
+			if err := add(native, name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for j := 1; j <= counts[p]; j++ {
+			if err := add(native+"_"+strconv.Itoa(j), name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return names, nil
+}
+
+// bindNative returns the query with its params replaced by named bindvars,
+// which are `@name` for AT and `:name` for any other bindType.  counts is as
+// for bind with an element for each of nq.unique, and a param with a non-zero
+// count is replaced by the list of bindvars `:name_1, :name_2, ...`.
+func (nq *namedQuery) bindNative(bindType int, counts []int) string {
+	prefix := ":"
+	if bindType == AT {
+		prefix = "@"
+	}
+	text := nq.texts(bindType)
+	var b strings.Builder
+	for i, name := range nq.names {
+		b.WriteString(text[i])
+		name = nativeName(name)
+		p := nq.slots[i]
+		if counts == nil || counts[p] == 0 {
+			b.WriteString(prefix + name)
+			continue
+		}
+		for j := 1; j <= counts[p]; j++ {
+			if j > 1 {
+				b.WriteString(", ")
+			}
+			b.WriteString(prefix + name + "_" + strconv.Itoa(j))
+		}
+	}
+	b.WriteString(text[len(nq.names)])
+	return b.String()
+}
+
+// bindNativeArgs binds the query for bindType with arglist, the values for
+// nq.unique, as sql.NamedArg values.  Slices are expanded as they are by
+// bindArgs, with a sql.NamedArg for each element.
+func (nq *namedQuery) bindNativeArgs(bindType int, arglist []interface{}) (string, []interface{}, error) {
+	counts, arglist, err := expandSliceArgs(arglist, nq.uniqueInList)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+	names, err := nq.nativeNames(counts)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+	return nq.bindNative(bindType, counts), namedArgList(names, arglist), nil
+}
+
+// namedArgList returns args as sql.NamedArg values with the given names.  Args
+// which are already a sql.NamedArg are renamed, and others like sql.Out are
+// wrapped, so that output params can be bound from a struct or map.
+func namedArgList(names []string, args []interface{}) []interface{} {
+	named := make([]interface{}, len(args))
+	for i, arg := range args {
+		if na, ok := arg.(sql.NamedArg); ok {
+			na.Name = names[i]
+			named[i] = na
+			continue
+		}
+		named[i] = sql.Named(names[i], arg)
+	}
+	return named
+}
+
+// compile a NamedQuery into a query for bindType and the list of names which
+// are bound to its args.  Names used more than once are only listed once for
+// bindtypes where a bindvar can be repeated.
+func compileNamedQuery(qs []byte, bindType int) (query string, names []string, err error) {
+	nq, err := parseNamedQuery(qs, dialectFor(bindType))
+	if err != nil {
+		return "", []string{}, err
+	}
+	return nq.bind(bindType, nil), nq.params(bindType), nil
 }
 
 // BindNamed binds a struct or a map to a query with named parameters.
@@ -414,32 +1149,100 @@ func BindNamed(bindType int, query string, arg interface{}) (string, []interface
 // Named takes a query using named parameters and an argument and
 // returns a new query with a list of args that can be executed by
 // a database.  The return value uses the `?` bindvar.
+//
+// A param which is the only item of an `IN (...)` list and whose value is a
+// slice is expanded into a list of bindvars, as with In, so that a query like
+// `WHERE id IN (:ids)` can bind a slice of ids.  Slices bound to params
+// anywhere else are passed to the driver as they are, eg. for array columns.
+// When binding for DOLLAR or AT, a param used more than once in the query is
+// bound once and its bindvars are repeated, so `:id` used twice becomes `$1`
+// twice with a single arg.  A param used both in an `IN (...)` list and
+// elsewhere is bound once for each, so that the slice is only expanded in the
+// list.  In a batch insert, params are only reused within the same row, or
+// within the rest of the query around the rows.
+//
+// If arg is a slice or array, the query is bound as a batch insert, as it is
+// by NamedExec:  the tuple after VALUES is repeated for each element, and the
+// params outside of it are bound once to the first element, so it is an error
+// for any other element to have a different value for one of them.
+//
+// Earlier versions bound every use of a param to a bindvar of its own, so this
+// changes the bindvars of such queries and the Params of a NamedStmt prepared
+// from them.  As postgres deduces a single type for each bindvar, a param used
+// where different types are expected, like `:v = int_col OR :v = text_col`, now
+// fails with "inconsistent types deduced for parameter";  cast it, as in
+// `:v::text`, or use a different name for each use.
+//
+// A dotted name like `:user.address.city` is looked up through any mix of
+// nested structs and maps, like a JSON payload decoded into a map.
+//
+// A param written `:name?` is optional and is bound to NULL if arg has no such
+// name, and one written `:{name=default}` is bound to its default instead.  The
+// default can be a 'string', a number, true, false or NULL.
+//
+// To bind params from more than one struct or map, pass them as a MergedArgs.
 func Named(query string, arg interface{}) (string, []interface{}, error) {
 	return bindNamedMapper(QUESTION, query, arg, mapper())
 }
 
 func bindNamedMapper(bindType int, query string, arg interface{}, m *reflectx.Mapper) (string, []interface{}, error) {
+	return bindNamedCache(bindType, dialectFor(bindType), query, arg, m, nil)
+}
+
+// bindNamedCache is bindNamedMapper, lexing query with d and getting the parsed
+// query from c.
+func bindNamedCache(bindType int, d sqllex.Dialect, query string, arg interface{}, m *reflectx.Mapper, c *QueryCache) (string, []interface{}, error) {
 	t := reflect.TypeOf(arg)
 	k := t.Kind()
-	switch {
-	case k == reflect.Map && t.Key().Kind() == reflect.String:
-		m, ok := convertMapStringInterface(arg)
+	if k == reflect.Array || k == reflect.Slice {
+		bq, err := c.parseBatch(query, bindType, d)
+		if err != nil {
+			return "", []interface{}{}, err
+		}
+		return bq.bindArray(bindType, arg, m)
+	}
+
+	nq, err := c.parseNamed(query, bindType, d)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+	if k == reflect.Map && t.Key().Kind() == reflect.String {
+		maparg, ok := convertMapStringInterface(arg)
 		if !ok {
 			return "", nil, fmt.Errorf("sqlx.bindNamedMapper: unsupported map type: %T", arg)
 		}
-		return bindMap(bindType, query, m)
-	case k == reflect.Array || k == reflect.Slice:
-		return bindArray(bindType, query, arg, m)
-	default:
-		return bindStruct(bindType, query, arg, m)
+		return nq.bindMap(bindType, maparg, m)
+	}
+	return nq.bindStruct(bindType, arg, m)
+}
+
+// bindNamedDriver is bindNamedCache for the bindtype and dialect of driverName.  If
+// NamedArgs is set for the driver, the query is bound with sql.NamedArg values
+// unless arg is a slice for a batch insert, whose rows would repeat names.
+func bindNamedDriver(driverName string, query string, arg interface{}, m *reflectx.Mapper, c *QueryCache) (string, []interface{}, error) {
+	bindType, d := BindType(driverName), driverDialect(driverName)
+	if k := reflect.TypeOf(arg).Kind(); !NamedArgs(driverName) || k == reflect.Array || k == reflect.Slice {
+		return bindNamedCache(bindType, d, query, arg, m, c)
+	}
+	nq, err := c.parseNamed(query, bindType, d)
+	if err != nil {
+		return "", []interface{}{}, err
 	}
+	arglist, err := bindAnyArgs(nq.unique, arg, m, nq.defaults)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+	return nq.bindNativeArgs(bindType, arglist)
 }
 
 // NamedQuery binds a named query and then runs Query on the result using the
 // provided Ext (sqlx.Tx, sqlx.Db).  It works with both structs and with
 // map[string]interface{} types.
+//
+// If NamedArgs is set for the driver, the params are passed to the driver as
+// sql.NamedArg values, and sql.Out values in arg can be used for output params.
 func NamedQuery(e Ext, query string, arg interface{}) (*Rows, error) {
-	q, args, err := bindNamedMapper(BindType(e.DriverName()), query, arg, mapperFor(e))
+	q, args, err := bindNamedDriver(e.DriverName(), query, arg, mapperFor(e), cacheFor(e))
 	if err != nil {
 		return nil, err
 	}
@@ -449,10 +1252,80 @@ func NamedQuery(e Ext, query string, arg interface{}) (*Rows, error) {
 // NamedExec uses BindStruct to get a query executable by the driver and
 // then runs Exec on the result.  Returns an error from the binding
 // or the query execution itself.
+//
+// If arg is a slice or array, the query is a batch insert:  the tuple after
+// VALUES is repeated for each element of arg.  Params outside of it, like those
+// in an ON CONFLICT, ON DUPLICATE KEY UPDATE or RETURNING clause, are bound
+// once to the first element, and it is an error for any other element to have
+// a different value for one of them.  A query without a VALUES list, like
+// INSERT ... SELECT, can only be bound to a slice of one element.
+//
+// If the bindvars of a batch insert, counting each element of a slice expanded
+// in an `IN (...)` list, would exceed the BindLimit of the driver, the batch is
+// split and Exec is run once for each part, with the params outside of the
+// VALUES tuple still bound to the first element of arg.  The sql.Result's
+// RowsAffected is then the total for all parts and its LastInsertId is that of
+// the last part.  The parts are not run atomically, so use a transaction if
+// the batch should be all or nothing.
+//
+// If NamedArgs is set for the driver, the params of a query which isn't a batch
+// are passed as sql.NamedArg values, as they are by NamedQuery.
 func NamedExec(e Ext, query string, arg interface{}) (sql.Result, error) {
-	q, args, err := bindNamedMapper(BindType(e.DriverName()), query, arg, mapperFor(e))
+	return namedExec(e.DriverName(), mapperFor(e), cacheFor(e), query, arg, func(q string, args []interface{}) (sql.Result, error) {
+		return e.Exec(q, args...)
+	})
+}
+
+// namedExec binds arg to query and runs exec for each chunk of it.
+func namedExec(driverName string, m *reflectx.Mapper, c *QueryCache, query string, arg interface{}, exec func(q string, args []interface{}) (sql.Result, error)) (sql.Result, error) {
+	if k := reflect.TypeOf(arg).Kind(); k != reflect.Array && k != reflect.Slice {
+		q, args, err := bindNamedDriver(driverName, query, arg, m, c)
+		if err != nil {
+			return nil, err
+		}
+		return exec(q, args)
+	}
+
+	bindType := BindType(driverName)
+	bq, err := c.parseBatch(query, bindType, driverDialect(driverName))
+	if err != nil {
+		return nil, err
+	}
+	qs, arglists, err := bq.bindChunks(bindType, arg, m, BindLimit(driverName))
 	if err != nil {
 		return nil, err
 	}
-	return e.Exec(q, args...)
+	results := make(batchResult, 0, len(qs))
+	for i, q := range qs {
+		res, err := exec(q, arglists[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	return results, nil
+}
+
+// batchResult is the sql.Result of a batch which was run in several parts.
+type batchResult []sql.Result
+
+// LastInsertId returns the LastInsertId of the last part of the batch.
+func (r batchResult) LastInsertId() (int64, error) {
+	return r[len(r)-1].LastInsertId()
+}
+
+// RowsAffected returns the total rows affected by all parts of the batch.
+func (r batchResult) RowsAffected() (int64, error) {
+	var total int64
+	for _, res := range r {
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
 }
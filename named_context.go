@@ -6,6 +6,9 @@ package sqlx
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
 )
 
 // A union interface of contextPreparer and binder, required to be able to
@@ -16,26 +19,22 @@ type namedPreparerContext interface {
 }
 
 func prepareNamedContext(ctx context.Context, p namedPreparerContext, query string) (*NamedStmt, error) {
-	bindType := BindType(p.DriverName())
-	q, args, err := compileNamedQuery([]byte(query), bindType)
+	n, err := compileNamedStmt(p.DriverName(), query)
 	if err != nil {
 		return nil, err
 	}
-	stmt, err := PreparexContext(ctx, p, q)
+	n.Stmt, err = PreparexContext(ctx, p, n.QueryString)
 	if err != nil {
 		return nil, err
 	}
-	return &NamedStmt{
-		QueryString: q,
-		Params:      args,
-		Stmt:        stmt,
-	}, nil
+	n.db, _ = p.(*DB)
+	return n, nil
 }
 
 // ExecContext executes a named statement using the struct passed.
 // Any named placeholder parameters are replaced with fields from arg.
 func (n *NamedStmt) ExecContext(ctx context.Context, arg interface{}) (sql.Result, error) {
-	args, err := bindAnyArgs(n.Params, arg, n.Stmt.Mapper)
+	args, err := n.bindArgs(arg)
 	if err != nil {
 		return *new(sql.Result), err
 	}
@@ -45,7 +44,7 @@ func (n *NamedStmt) ExecContext(ctx context.Context, arg interface{}) (sql.Resul
 // QueryContext executes a named statement using the struct argument, returning rows.
 // Any named placeholder parameters are replaced with fields from arg.
 func (n *NamedStmt) QueryContext(ctx context.Context, arg interface{}) (*sql.Rows, error) {
-	args, err := bindAnyArgs(n.Params, arg, n.Stmt.Mapper)
+	args, err := n.bindArgs(arg)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +56,7 @@ func (n *NamedStmt) QueryContext(ctx context.Context, arg interface{}) (*sql.Row
 // returns a *sqlx.Row instead.
 // Any named placeholder parameters are replaced with fields from arg.
 func (n *NamedStmt) QueryRowContext(ctx context.Context, arg interface{}) *Row {
-	args, err := bindAnyArgs(n.Params, arg, n.Stmt.Mapper)
+	args, err := n.bindArgs(arg)
 	if err != nil {
 		return &Row{err: err}
 	}
@@ -110,11 +109,151 @@ func (n *NamedStmt) GetContext(ctx context.Context, dest interface{}, arg interf
 	return r.scanAny(dest, false)
 }
 
+// BatchOptions control how NamedStmt.ExecBatch runs a batch.
+type BatchOptions struct {
+	// ContinueOnError runs every element of the batch even if some of them
+	// fail.  By default, ExecBatch stops at the first error.
+	ContinueOnError bool
+	// Tx runs the batch in a transaction, which is committed if every element
+	// succeeds and rolled back otherwise.  It can only be used on statements
+	// prepared on a DB.  Combining it with ContinueOnError is pointless on
+	// postgres, where every statement after the first error in a transaction
+	// fails with "current transaction is aborted", so the errors after the
+	// first say nothing about their elements.
+	Tx bool
+	// TxOptions are the options of the transaction used if Tx is set.
+	TxOptions *sql.TxOptions
+}
+
+// BatchResult is the result of running a NamedStmt for a batch.
+type BatchResult struct {
+	// Rows has the result of each element of the batch which was run, in
+	// order.  It is shorter than the batch if ExecBatch stopped early.
+	Rows []BatchRowResult
+	// RowsAffected is the total RowsAffected of the elements which succeeded.
+	// It is 0 if the batch was rolled back.
+	RowsAffected int64
+	// Failed is the number of elements which failed.
+	Failed int
+	// RolledBack is whether the batch ran in a transaction which was rolled
+	// back or failed to commit, so that none of its rows were kept.  The
+	// RowsAffected of each of Rows is then 0, though their Result still has
+	// what the driver reported before the rollback.  If the rollback itself
+	// failed, RolledBack is false, RowsAffected is as the driver reported it
+	// and the error returned by ExecBatch includes that of the rollback.
+	RolledBack bool
+}
+
+// BatchRowResult is the result of running a NamedStmt for one element of a
+// batch.  If the element failed, Err is set and Result is nil.  RowsAffected is
+// -1 if the driver doesn't report it.
+type BatchRowResult struct {
+	Result       sql.Result
+	RowsAffected int64
+	Err          error
+}
+
+// ExecBatch executes the named statement once for each element of arg, which
+// must be a slice or an array of structs or maps, reusing the prepared
+// statement.  The result has the rows affected and any error of each element.
+// If opts is nil, ExecBatch stops at the first error and doesn't use a
+// transaction.  The error returned is that of the first element which failed,
+// or of starting or committing the transaction, and ExecBatch always stops if
+// ctx is done.
+func (n *NamedStmt) ExecBatch(ctx context.Context, arg interface{}, opts *BatchOptions) (*BatchResult, error) {
+	v := reflect.ValueOf(arg)
+	if k := v.Kind(); k != reflect.Slice && k != reflect.Array {
+		return nil, fmt.Errorf("sqlx: ExecBatch needs a slice or array, got %T", arg)
+	}
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+
+	stmt := n
+	var tx *Tx
+	if opts.Tx {
+		if n.db == nil {
+			return nil, errors.New("sqlx: ExecBatch can only use a transaction for statements prepared on a DB")
+		}
+		var err error
+		if tx, err = n.db.BeginTxx(ctx, opts.TxOptions); err != nil {
+			return nil, err
+		}
+		stmt = tx.NamedStmtContext(ctx, n)
+	}
+
+	res := &BatchResult{Rows: make([]BatchRowResult, 0, v.Len())}
+	var first error
+	for i := 0; i < v.Len(); i++ {
+		if err := ctx.Err(); err != nil {
+			if first == nil {
+				first = err
+			}
+			break
+		}
+		row := BatchRowResult{RowsAffected: -1}
+		row.Result, row.Err = stmt.ExecContext(ctx, v.Index(i).Interface())
+		if row.Err != nil {
+			row.Result = nil
+			res.Failed++
+			if first == nil {
+				first = fmt.Errorf("batch element %d: %w", i, row.Err)
+			}
+		} else if affected, err := row.Result.RowsAffected(); err == nil {
+			row.RowsAffected = affected
+			res.RowsAffected += affected
+		}
+		res.Rows = append(res.Rows, row)
+		if row.Err != nil && !opts.ContinueOnError {
+			break
+		}
+	}
+
+	if tx != nil {
+		first = res.endTx(tx, first)
+	}
+	return res, first
+}
+
+// endTx commits the transaction of a batch if first, its error, is nil, and
+// rolls it back otherwise, returning the error of the batch.  If the rollback
+// fails, the result isn't marked as rolled back, as nobody knows whether its
+// rows were kept, and the error of the rollback is joined to first.
+func (r *BatchResult) endTx(tx interface {
+	Commit() error
+	Rollback() error
+}, first error) error {
+	if first == nil {
+		if err := tx.Commit(); err != nil {
+			r.rolledBack()
+			return err
+		}
+		return nil
+	}
+	// if ctx was done, database/sql has already rolled the transaction back
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return errors.Join(first, fmt.Errorf("sqlx: rolling back batch: %w", err))
+	}
+	r.rolledBack()
+	return first
+}
+
+// rolledBack marks the result of a batch whose transaction was rolled back.
+func (r *BatchResult) rolledBack() {
+	r.RolledBack = true
+	r.RowsAffected = 0
+	for i := range r.Rows {
+		if r.Rows[i].Err == nil {
+			r.Rows[i].RowsAffected = 0
+		}
+	}
+}
+
 // NamedQueryContext binds a named query and then runs Query on the result using the
 // provided Ext (sqlx.Tx, sqlx.Db).  It works with both structs and with
 // map[string]interface{} types.
 func NamedQueryContext(ctx context.Context, e ExtContext, query string, arg interface{}) (*Rows, error) {
-	q, args, err := bindNamedMapper(BindType(e.DriverName()), query, arg, mapperFor(e))
+	q, args, err := bindNamedDriver(e.DriverName(), query, arg, mapperFor(e), cacheFor(e))
 	if err != nil {
 		return nil, err
 	}
@@ -124,10 +263,9 @@ func NamedQueryContext(ctx context.Context, e ExtContext, query string, arg inte
 // NamedExecContext uses BindStruct to get a query executable by the driver and
 // then runs Exec on the result.  Returns an error from the binding
 // or the query execution itself.
+// See NamedExec for how large batches are split.
 func NamedExecContext(ctx context.Context, e ExtContext, query string, arg interface{}) (sql.Result, error) {
-	q, args, err := bindNamedMapper(BindType(e.DriverName()), query, arg, mapperFor(e))
-	if err != nil {
-		return nil, err
-	}
-	return e.ExecContext(ctx, q, args...)
+	return namedExec(e.DriverName(), mapperFor(e), cacheFor(e), query, arg, func(q string, args []interface{}) (sql.Result, error) {
+		return e.ExecContext(ctx, q, args...)
+	})
 }
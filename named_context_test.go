@@ -6,6 +6,8 @@ package sqlx
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -135,3 +137,137 @@ func TestNamedContextQueries(t *testing.T) {
 
 	})
 }
+
+func TestNamedStmtExecBatch(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		ctx := context.Background()
+		ns, err := db.PrepareNamedContext(ctx, `INSERT INTO place (country, telcode) VALUES (:country, :telcode)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+
+		count := func(country string) int {
+			var n int
+			db.Get(&n, db.Rebind(`SELECT count(*) FROM place WHERE country = ?`), country)
+			return n
+		}
+		// the third element is missing its telcode, so it fails to bind
+		batch := func(country string) []map[string]interface{} {
+			return []map[string]interface{}{
+				{"country": country, "telcode": 1},
+				{"country": country, "telcode": 2},
+				{"country": country},
+				{"country": country, "telcode": 4},
+			}
+		}
+
+		res, err := ns.ExecBatch(ctx, batch("stop"), nil)
+		if err == nil || !strings.Contains(err.Error(), "batch element 2") {
+			t.Errorf("expected an error for element 2, got %v", err)
+		}
+		if len(res.Rows) > 2 && !errors.Is(err, res.Rows[2].Err) {
+			t.Errorf("expected %v to wrap the error of element 2", err)
+		}
+		if len(res.Rows) != 3 || res.Failed != 1 || res.RowsAffected != 2 || res.Rows[2].Err == nil || res.Rows[1].RowsAffected != 1 {
+			t.Errorf("unexpected result %+v", res)
+		}
+		if n := count("stop"); n != 2 {
+			t.Errorf("expected 2 rows, got %d", n)
+		}
+
+		res, err = ns.ExecBatch(ctx, batch("continue"), &BatchOptions{ContinueOnError: true})
+		if err == nil {
+			t.Error("expected an error")
+		}
+		if len(res.Rows) != 4 || res.Failed != 1 || res.RowsAffected != 3 || res.Rows[3].Err != nil {
+			t.Errorf("unexpected result %+v", res)
+		}
+		if n := count("continue"); n != 3 {
+			t.Errorf("expected 3 rows, got %d", n)
+		}
+
+		// a failed batch in a transaction is rolled back
+		res, err = ns.ExecBatch(ctx, batch("rollback"), &BatchOptions{Tx: true, ContinueOnError: true})
+		if err == nil || !res.RolledBack || res.RowsAffected != 0 || res.Rows[0].RowsAffected != 0 {
+			t.Errorf("expected an error and no rows affected, got %v %+v", err, res)
+		}
+		if n := count("rollback"); n != 0 {
+			t.Errorf("expected 0 rows, got %d", n)
+		}
+
+		rows := []Place{{Country: "commit", TelCode: 1}, {Country: "commit", TelCode: 2}}
+		res, err = ns.ExecBatch(ctx, rows, &BatchOptions{Tx: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Rows) != 2 || res.RowsAffected != 2 || res.Failed != 0 || res.RolledBack {
+			t.Errorf("unexpected result %+v", res)
+		}
+		if n := count("commit"); n != 2 {
+			t.Errorf("expected 2 rows, got %d", n)
+		}
+
+		if _, err := ns.ExecBatch(ctx, rows[0], nil); err == nil {
+			t.Error("expected an error for an argument which isn't a slice")
+		}
+
+		tx := db.MustBegin()
+		defer tx.Rollback()
+		if _, err := tx.NamedStmtContext(ctx, ns).ExecBatch(ctx, rows, &BatchOptions{Tx: true}); err == nil {
+			t.Error("expected an error using a transaction for a statement on a Tx")
+		}
+		res, err = tx.NamedStmtContext(ctx, ns).ExecBatch(ctx, rows, nil)
+		if err != nil || res.RowsAffected != 2 {
+			t.Errorf("unexpected result %v %+v", err, res)
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if res, err := ns.ExecBatch(cancelled, rows, nil); err != context.Canceled || len(res.Rows) != 0 {
+			t.Errorf("expected the batch to stop when ctx is done, got %v %+v", err, res)
+		}
+	})
+}
+
+type fakeTx struct {
+	commit, rollback error
+}
+
+func (tx fakeTx) Commit() error   { return tx.commit }
+func (tx fakeTx) Rollback() error { return tx.rollback }
+
+func TestBatchResultEndTx(t *testing.T) {
+	failed := errors.New("element failed")
+	newResult := func() *BatchResult {
+		return &BatchResult{Rows: []BatchRowResult{{RowsAffected: 1}, {RowsAffected: -1, Err: failed}}, RowsAffected: 1, Failed: 1}
+	}
+
+	// a rollback which fails leaves the result as it is and joins its error
+	broken := errors.New("connection lost")
+	res := newResult()
+	err := res.endTx(fakeTx{rollback: broken}, failed)
+	if !errors.Is(err, failed) || !errors.Is(err, broken) {
+		t.Errorf("expected %v to wrap both errors", err)
+	}
+	if res.RolledBack || res.RowsAffected != 1 || res.Rows[0].RowsAffected != 1 {
+		t.Errorf("expected the result not to be marked as rolled back, got %+v", res)
+	}
+
+	// one which database/sql already did when ctx was done is not an error
+	for _, rollback := range []error{nil, sql.ErrTxDone} {
+		res = newResult()
+		if err := res.endTx(fakeTx{rollback: rollback}, failed); err != failed {
+			t.Errorf("expected %v, got %v", failed, err)
+		}
+		if !res.RolledBack || res.RowsAffected != 0 || res.Rows[0].RowsAffected != 0 {
+			t.Errorf("expected the result to be rolled back, got %+v", res)
+		}
+	}
+
+	// a commit which fails marks the result as rolled back
+	res = newResult()
+	if err := res.endTx(fakeTx{commit: broken}, nil); err != broken || !res.RolledBack {
+		t.Errorf("expected a rolled back commit error, got %v %+v", err, res)
+	}
+}
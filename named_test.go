@@ -3,7 +3,11 @@ package sqlx
 import (
 	"database/sql"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/jmoiron/sqlx/sqllex"
 )
 
 func TestCompileQuery(t *testing.T) {
@@ -53,16 +57,31 @@ func TestCompileQuery(t *testing.T) {
 			T: `SELECT @name := "name", @p1, @p2, @p3`,
 			V: []string{"age", "first", "last"},
 		},
-		/* This unicode awareness test sadly fails, because of our byte-wise worldview.
-		 * We could certainly iterate by Rune instead, though it's a great deal slower,
-		 * it's probably the RightWay(tm)
 		{
 			Q: `INSERT INTO foo (a,b,c,d) VALUES (:あ, :b, :キコ, :名前)`,
 			R: `INSERT INTO foo (a,b,c,d) VALUES (?, ?, ?, ?)`,
 			D: `INSERT INTO foo (a,b,c,d) VALUES ($1, $2, $3, $4)`,
-			N: []string{"name", "age", "first", "last"},
+			T: `INSERT INTO foo (a,b,c,d) VALUES (@p1, @p2, @p3, @p4)`,
+			N: `INSERT INTO foo (a,b,c,d) VALUES (:あ, :b, :キコ, :名前)`,
+			V: []string{"あ", "b", "キコ", "名前"},
+		},
+		{
+			Q: `SELECT * FROM café WHERE crème=:crème AND prix::numeric > :prix_€ AND n=:n٣`,
+			R: `SELECT * FROM café WHERE crème=? AND prix:numeric > ?€ AND n=?`,
+			D: `SELECT * FROM café WHERE crème=$1 AND prix:numeric > $2€ AND n=$3`,
+			T: `SELECT * FROM café WHERE crème=@p1 AND prix:numeric > @p2€ AND n=@p3`,
+			N: `SELECT * FROM café WHERE crème=:crème AND prix:numeric > :prix_€ AND n=:n٣`,
+			V: []string{"crème", "prix_", "n٣"},
+		},
+		// repeated names reuse the bindvar of their first use where they can
+		{
+			Q: `SELECT * FROM a WHERE tenant=:tenant AND (owner=:user OR :user IS NULL) AND b.tenant=:tenant`,
+			R: `SELECT * FROM a WHERE tenant=? AND (owner=? OR ? IS NULL) AND b.tenant=?`,
+			D: `SELECT * FROM a WHERE tenant=$1 AND (owner=$2 OR $2 IS NULL) AND b.tenant=$1`,
+			T: `SELECT * FROM a WHERE tenant=@p1 AND (owner=@p2 OR @p2 IS NULL) AND b.tenant=@p1`,
+			N: `SELECT * FROM a WHERE tenant=:tenant AND (owner=:user OR :user IS NULL) AND b.tenant=:tenant`,
+			V: []string{"tenant", "user", "user", "tenant"},
 		},
-		*/
 	}
 
 	for _, test := range table {
@@ -99,6 +118,36 @@ func TestCompileQuery(t *testing.T) {
 	}
 }
 
+func TestNamedStmtParams(t *testing.T) {
+	q := `SELECT * FROM a WHERE tenant=:tenant AND (owner=:user OR :user IS NULL) AND b.tenant=:tenant`
+	table := []struct {
+		driverName, query string
+		params            []string
+	}{
+		{"postgres", `SELECT * FROM a WHERE tenant=$1 AND (owner=$2 OR $2 IS NULL) AND b.tenant=$1`, []string{"tenant", "user"}},
+		{"mysql", `SELECT * FROM a WHERE tenant=? AND (owner=? OR ? IS NULL) AND b.tenant=?`, []string{"tenant", "user", "user", "tenant"}},
+	}
+	for _, test := range table {
+		n, err := compileNamedStmt(test.driverName, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.QueryString != test.query {
+			t.Errorf("%s:\nexpected: `%s`\ngot:      `%s`", test.driverName, test.query, n.QueryString)
+		}
+		if !reflect.DeepEqual(n.Params, test.params) {
+			t.Errorf("%s: expected params %v, got %v", test.driverName, test.params, n.Params)
+		}
+	}
+}
+
+func BenchmarkCompileNamedQuery(b *testing.B) {
+	q := []byte(`INSERT INTO person (first_name, last_name, email, added_at) VALUES (:first_name, :last_name, :email, :added_at) ON CONFLICT (email) DO UPDATE SET first_name = :first_name`)
+	for i := 0; i < b.N; i++ {
+		_, _, _ = compileNamedQuery(q, DOLLAR)
+	}
+}
+
 type Test struct {
 	t *testing.T
 }
@@ -122,13 +171,63 @@ func (t Test) Errorf(err error, format string, args ...interface{}) {
 }
 
 func TestEscapedColons(t *testing.T) {
-	t.Skip("not sure it is possible to support this in general case without an SQL parser")
 	var qs = `SELECT * FROM testtable WHERE timeposted BETWEEN (now() AT TIME ZONE 'utc') AND
 	(now() AT TIME ZONE 'utc') - interval '01:30:00') AND name = '\'this is a test\'' and id = :id`
-	_, _, err := compileNamedQuery([]byte(qs), DOLLAR)
+	_, names, err := compileNamedQuery([]byte(qs), DOLLAR)
 	if err != nil {
 		t.Error("Didn't handle colons correctly when inside a string")
 	}
+	if len(names) != 1 || names[0] != "id" {
+		t.Errorf("expected [id], got %v", names)
+	}
+}
+
+func TestNamedLiterals(t *testing.T) {
+	table := []struct {
+		name     string
+		bindType int
+		q        string
+		expect   string
+		names    []string
+	}{
+		{"string", DOLLAR,
+			`INSERT INTO t (at, id) VALUES ('12:30', :id)`,
+			`INSERT INTO t (at, id) VALUES ('12:30', $1)`, []string{"id"}},
+		{"escaped string", DOLLAR,
+			`SELECT E'it\'s :a', :b`,
+			`SELECT E'it\'s :a', $1`, []string{"b"}},
+		{"quoted identifier", DOLLAR,
+			`SELECT "a:b", :c`,
+			`SELECT "a:b", $1`, []string{"c"}},
+		{"bracket identifier", AT,
+			`SELECT [a:b], :c`,
+			`SELECT [a:b], @p1`, []string{"c"}},
+		{"line comment", QUESTION,
+			"SELECT :a -- no :b or x::int here\nFROM t",
+			"SELECT ? -- no :b or x::int here\nFROM t", []string{"a"}},
+		{"block comment", DOLLAR,
+			`SELECT /* :a and x::int */ :b`,
+			`SELECT /* :a and x::int */ $1`, []string{"b"}},
+		{"dollar quoted body", DOLLAR,
+			`CREATE FUNCTION f(a int) RETURNS int AS $$ SELECT a::int + :b $$ LANGUAGE sql`,
+			`CREATE FUNCTION f(a int) RETURNS int AS $$ SELECT a::int + :b $$ LANGUAGE sql`, []string{}},
+		{"tagged dollar quoted body", DOLLAR,
+			`DO $body$ BEGIN PERFORM '$$ :a'; END $body$; SELECT CAST(:b AS text)`,
+			`DO $body$ BEGIN PERFORM '$$ :a'; END $body$; SELECT CAST($1 AS text)`, []string{"b"}},
+	}
+	for _, test := range table {
+		q, names, err := compileNamedQuery([]byte(test.q), test.bindType)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if q != test.expect {
+			t.Errorf("%s:\nexpected: `%s`\ngot:      `%s`", test.name, test.expect, q)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: expected names %v, got %v", test.name, test.names, names)
+		}
+	}
 }
 
 func TestNamedQueries(t *testing.T) {
@@ -234,6 +333,13 @@ func TestNamedQueries(t *testing.T) {
 			VALUES (:first_name, :last_name, :email) ;--`, typedMap)
 		test.Error(err)
 
+		// INSERT ... SELECT can't be a batch of more than one row
+		_, err = db.NamedExec(`INSERT INTO person (first_name, last_name, email)
+			SELECT :first_name, :last_name, :email || '.select'`, slsMap)
+		if err == nil {
+			t.Error("expected an error for an INSERT ... SELECT batch")
+		}
+
 		for _, p := range sls {
 			dest := Person{}
 			err = db.Get(&dest, db.Rebind("SELECT * FROM person WHERE email=?"), p.Email)
@@ -302,7 +408,7 @@ func TestNamedQueries(t *testing.T) {
 	})
 }
 
-func TestFixBounds(t *testing.T) {
+func TestSplitBatch(t *testing.T) {
 	table := []struct {
 		name, query, expect string
 		loop                int
@@ -424,12 +530,747 @@ func TestFixBounds(t *testing.T) {
 		},
 	}
 
+	// repeat the batch row of query loop times
+	repeat := func(query string, loop int) string {
+		start, end, sep, ok := splitBatch(query, sqllex.Generic)
+		if !ok {
+			return query
+		}
+		rows := make([]string, loop)
+		for i := range rows {
+			rows[i] = query[start:end]
+		}
+		return query[:start] + strings.Join(rows, sep) + query[end:]
+	}
+
 	for _, tc := range table {
 		t.Run(tc.name, func(t *testing.T) {
-			res := fixBound(tc.query, tc.loop)
+			res := repeat(tc.query, tc.loop)
 			if res != tc.expect {
-				t.Errorf("mismatched results")
+				t.Errorf("mismatched results:\nexpected: `%s`\ngot:      `%s`", tc.expect, res)
 			}
 		})
 	}
 }
+
+func TestBindBatch(t *testing.T) {
+	type row struct {
+		A int    `db:"a"`
+		B string `db:"b"`
+		C string `db:"c"`
+	}
+	rows := []row{{1, "x", "z"}, {2, "y", "z"}}
+
+	table := []struct {
+		name, query, expect string
+		args                []interface{}
+	}{
+		{"conflict params are bound once",
+			`INSERT INTO foo (a, b) VALUES (:a, :b) ON CONFLICT (a) DO UPDATE SET c = :c RETURNING a, :c AS c`,
+			`INSERT INTO foo (a, b) VALUES ($1, $2),($3, $4) ON CONFLICT (a) DO UPDATE SET c = $5 RETURNING a, $5 AS c`,
+			[]interface{}{1, "x", 2, "y", "z"}},
+		{"literal question marks",
+			`INSERT INTO foo (a, b) VALUES (:a, :b ?? 'k') ON CONFLICT (a) DO UPDATE SET b = foo.b ? :c`,
+			`INSERT INTO foo (a, b) VALUES ($1, $2 ? 'k'),($3, $4 ? 'k') ON CONFLICT (a) DO UPDATE SET b = foo.b ? $5`,
+			[]interface{}{1, "x", 2, "y", "z"}},
+		{"parentheses in literals",
+			`INSERT INTO foo (a, b) VALUES (:a, ')(' || :b) -- )`,
+			`INSERT INTO foo (a, b) VALUES ($1, ')(' || $2),($3, ')(' || $4) -- )`,
+			[]interface{}{1, "x", 2, "y"}},
+		{"no column list",
+			`INSERT INTO foo VALUES (:a, :b) ON DUPLICATE KEY UPDATE b = VALUES(b)`,
+			`INSERT INTO foo VALUES ($1, $2),($3, $4) ON DUPLICATE KEY UPDATE b = VALUES(b)`,
+			[]interface{}{1, "x", 2, "y"}},
+	}
+	for _, test := range table {
+		q, args, err := bindNamedMapper(DOLLAR, test.query, rows, mapper())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if q != test.expect {
+			t.Errorf("%s:\nexpected: `%s`\ngot:      `%s`", test.name, test.expect, q)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: expected args %v, got %v", test.name, test.args, args)
+		}
+	}
+
+	// params bound once can't have different values in different rows
+	for _, q := range []string{
+		`INSERT INTO foo (a, b) VALUES (:a, :c) ON CONFLICT (a) DO UPDATE SET b = :b`,
+		`WITH t AS (SELECT :b AS b) INSERT INTO foo (a, b) VALUES (:a, :c)`,
+	} {
+		if _, _, err := bindNamedMapper(DOLLAR, q, rows, mapper()); err == nil || !strings.Contains(err.Error(), "batch element 1") {
+			t.Errorf("%s: expected an error for different values of b, got %v", q, err)
+		}
+	}
+
+	// there's nothing to repeat for many rows, but one row is fine
+	queries := []string{
+		`UPDATE foo SET b = :b WHERE a = :a`,
+		`WITH t AS (SELECT :a AS a) INSERT INTO foo (a, b) SELECT :a, b FROM bar WHERE b IN (VALUES (:b))`,
+	}
+	for _, q := range queries {
+		if _, _, err := bindNamedMapper(DOLLAR, q, rows, mapper()); err == nil {
+			t.Errorf("%s: expected an error binding many rows", q)
+		}
+		if _, args, err := bindNamedMapper(DOLLAR, q, rows[:1], mapper()); err != nil || len(args) < 2 {
+			t.Errorf("%s: expected args, got %v (%v)", q, args, err)
+		}
+	}
+	var q string
+
+	// `??` is unescaped as it is by Rebind and In, whether or not arg is a
+	// batch, except for QUESTION, whose bindvars it is escaped from
+	q = `SELECT * FROM foo WHERE a = :a AND b ?? 'k'`
+	for _, bindType := range []int{DOLLAR, QUESTION} {
+		single, _, err := bindNamedMapper(bindType, q, rows[0], mapper())
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch, _, err := bindNamedMapper(bindType, q, rows[:1], mapper())
+		if err != nil {
+			t.Fatal(err)
+		}
+		in, _, err := In(`SELECT * FROM foo WHERE a = ? AND b ?? 'k'`, rows[0].A)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := Rebind(bindType, in); single != expect || batch != expect {
+			t.Errorf("expected `%s`, got `%s` and `%s`", expect, single, batch)
+		}
+	}
+	if expect := `SELECT * FROM foo WHERE a = $1 AND b ? 'k'`; Rebind(DOLLAR, `SELECT * FROM foo WHERE a = ? AND b ?? 'k'`) != expect {
+		t.Errorf("expected Rebind to give `%s`", expect)
+	}
+}
+
+func TestBindChunks(t *testing.T) {
+	type row struct {
+		A   int    `db:"a"`
+		B   string `db:"b"`
+		IDs []int  `db:"ids"`
+	}
+	rows := [4]row{{1, "w", []int{1, 2, 3}}, {2, "w", []int{4}}, {3, "w", []int{5, 6}}, {4, "w", []int{7}}}
+	bq, err := parseBatchQuery(`INSERT INTO foo (a, b) VALUES (:a, (SELECT max(x) FROM bar WHERE x IN (:ids))) ON CONFLICT (a) DO UPDATE SET b = :b`, sqllex.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows are counted by their expanded bindvars, and every chunk binds its
+	// tail to the first element of the batch
+	expect := []string{
+		`INSERT INTO foo (a, b) VALUES ($1, (SELECT max(x) FROM bar WHERE x IN ($2, $3, $4))) ON CONFLICT (a) DO UPDATE SET b = $5`,
+		`INSERT INTO foo (a, b) VALUES ($1, (SELECT max(x) FROM bar WHERE x IN ($2))),($3, (SELECT max(x) FROM bar WHERE x IN ($4, $5))) ON CONFLICT (a) DO UPDATE SET b = $6`,
+		`INSERT INTO foo (a, b) VALUES ($1, (SELECT max(x) FROM bar WHERE x IN ($2))) ON CONFLICT (a) DO UPDATE SET b = $3`,
+	}
+	expectArgs := [][]interface{}{
+		{1, 1, 2, 3, "w"},
+		{2, 4, 3, 5, 6, "w"},
+		{4, 7, "w"},
+	}
+	for _, arg := range []interface{}{rows, rows[:]} {
+		qs, args, err := bq.bindChunks(DOLLAR, arg, mapper(), 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(qs, expect) {
+			t.Errorf("expected queries\n%s\ngot\n%s", strings.Join(expect, "\n"), strings.Join(qs, "\n"))
+		}
+		if !reflect.DeepEqual(args, expectArgs) {
+			t.Errorf("expected args %v, got %v", expectArgs, args)
+		}
+	}
+
+	// without a limit, or under it, there is one chunk
+	for _, limit := range []int{0, 13} {
+		if qs, _, err := bq.bindChunks(DOLLAR, rows[:], mapper(), limit); err != nil || len(qs) != 1 {
+			t.Errorf("limit %d: expected one chunk, got %d (%v)", limit, len(qs), err)
+		}
+	}
+
+	// a row which can't fit is an error
+	if _, _, err := bq.bindChunks(DOLLAR, rows[:], mapper(), 4); err == nil || !strings.Contains(err.Error(), "limit of 4") {
+		t.Errorf("expected a bind limit error, got %v", err)
+	}
+
+	// as is a tail param which differs, even in a later chunk
+	rows[3].B = "z"
+	if _, _, err := bq.bindChunks(DOLLAR, rows[:], mapper(), 6); err == nil || !strings.Contains(err.Error(), "batch element 3") {
+		t.Errorf("expected an error for a different b, got %v", err)
+	}
+}
+
+func TestNamedSlices(t *testing.T) {
+	type filter struct {
+		Country string `db:"country"`
+		Codes   []int  `db:"codes"`
+		Raw     []byte `db:"raw"`
+	}
+	f := filter{Country: "x", Codes: []int{1, 2, 3}, Raw: []byte("raw")}
+	m := map[string]interface{}{"country": "x", "codes": []string{"a", "b", "c"}, "raw": []byte("raw")}
+
+	q := `SELECT * FROM place WHERE country = :country AND telcode IN (:codes) AND raw = :raw`
+	table := []struct {
+		bindType int
+		expect   string
+	}{
+		{QUESTION, `SELECT * FROM place WHERE country = ? AND telcode IN (?, ?, ?) AND raw = ?`},
+		{DOLLAR, `SELECT * FROM place WHERE country = $1 AND telcode IN ($2, $3, $4) AND raw = $5`},
+		{AT, `SELECT * FROM place WHERE country = @p1 AND telcode IN (@p2, @p3, @p4) AND raw = @p5`},
+		{NAMED, `SELECT * FROM place WHERE country = :country AND telcode IN (:arg2, :arg3, :arg4) AND raw = :raw`},
+	}
+
+	for _, test := range table {
+		for _, arg := range []interface{}{f, &f, m} {
+			bound, args, err := bindNamedMapper(test.bindType, q, arg, mapper())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bound != test.expect {
+				t.Errorf("\nexpected: `%s`\ngot:      `%s`", test.expect, bound)
+			}
+			if len(args) != 5 {
+				t.Errorf("expected 5 args, got %d: %v", len(args), args)
+			}
+		}
+	}
+
+	// repeated slices reuse their whole list of bindvars
+	q2 := `SELECT * FROM place WHERE telcode IN (:codes) OR country = :country OR code IN (:codes)`
+	bound, args, err := bindNamedMapper(DOLLAR, q2, f, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM place WHERE telcode IN ($1, $2, $3) OR country = $4 OR code IN ($1, $2, $3)`; bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+	if expect := []interface{}{1, 2, 3, "x"}; !reflect.DeepEqual(args, expect) {
+		t.Errorf("expected %v, got %v", expect, args)
+	}
+	bound, args, err = bindNamedMapper(QUESTION, q2, m, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM place WHERE telcode IN (?, ?, ?) OR country = ? OR code IN (?, ?, ?)`; bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+	if len(args) != 7 {
+		t.Errorf("expected 7 args, got %d: %v", len(args), args)
+	}
+	_, names, _ := compileNamedQuery([]byte(q2), AT)
+	if expect := []string{"codes", "country"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("expected %v, got %v", expect, names)
+	}
+
+	_, _, err = Named(q, filter{Codes: []int{}})
+	if err == nil {
+		t.Error("expected an error binding an empty slice")
+	}
+
+	// slices outside of IN lists are bound as they are, eg. for array columns
+	type tagged struct {
+		Tags []string `db:"tags"`
+	}
+	bound, args, err = bindNamedMapper(DOLLAR, `INSERT INTO foo (tags) VALUES (:tags)`, tagged{Tags: []string{"x", "y"}}, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `INSERT INTO foo (tags) VALUES ($1)`; bound != expect || len(args) != 1 {
+		t.Errorf("\nexpected: `%s` with 1 arg\ngot:      `%s` with %v", expect, bound, args)
+	}
+	// a param used in and out of IN lists is only expanded in them, where it
+	// has bindvars of its own
+	q3 := `SELECT * FROM place WHERE telcode IN (:codes) OR code = ANY(:codes) OR telcode IN (:codes)`
+	bound, args, err = bindNamedMapper(DOLLAR, q3, f, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM place WHERE telcode IN ($1, $2, $3) OR code = ANY($4) OR telcode IN ($1, $2, $3)`; bound != expect || !reflect.DeepEqual(args, []interface{}{1, 2, 3, []int{1, 2, 3}}) {
+		t.Errorf("\nexpected: `%s` with 4 args\ngot:      `%s` with %v", expect, bound, args)
+	}
+	bound, args, err = bindNamedMapper(AT, `SELECT * FROM foo WHERE id IN (:ids) AND x = :ids`, map[string]interface{}{"ids": []int{1, 2}}, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM foo WHERE id IN (@p1, @p2) AND x = @p3`; bound != expect || len(args) != 3 {
+		t.Errorf("\nexpected: `%s` with 3 args\ngot:      `%s` with %v", expect, bound, args)
+	}
+	q3 = `SELECT * FROM place WHERE telcode IN (:codes) OR code = ANY(:codes)`
+	bound, args, err = bindNamedMapper(QUESTION, q3, f, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT * FROM place WHERE telcode IN (?, ?, ?) OR code = ANY(?)`; bound != expect || len(args) != 4 {
+		t.Errorf("\nexpected: `%s` with 4 args\ngot:      `%s` with %v", expect, bound, args)
+	}
+
+	// batch inserts expand slices in IN lists per element
+	rows := []map[string]interface{}{
+		{"a": 1, "b": []int{1, 2}},
+		{"a": 2, "b": []int{3}},
+	}
+	bound, args, err = bindNamedMapper(DOLLAR, `INSERT INTO foo (a, b) SELECT :a, :b FROM bar WHERE c IN (:b)`, rows[:1], mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `INSERT INTO foo (a, b) SELECT $1, $2 FROM bar WHERE c IN ($3, $4)`
+	if bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+	if len(args) != 4 {
+		t.Errorf("expected 4 args, got %d: %v", len(args), args)
+	}
+	bound, args, err = bindNamedMapper(DOLLAR, `INSERT INTO foo (a, b) VALUES (:a, :b)`, rows, mapper())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `INSERT INTO foo (a, b) VALUES ($1, $2),($3, $4)`
+	if bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+	if len(args) != 4 {
+		t.Errorf("expected 4 args, got %d: %v", len(args), args)
+	}
+
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		var places []Place
+		rows, err := db.NamedQuery(`SELECT * FROM place WHERE telcode IN (:codes) ORDER BY telcode`,
+			map[string]interface{}{"codes": []int{852, 65}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var p Place
+			if err := rows.StructScan(&p); err != nil {
+				t.Fatal(err)
+			}
+			places = append(places, p)
+		}
+		if len(places) != 2 || places[0].TelCode != 65 || places[1].TelCode != 852 {
+			t.Errorf("expected singapore and hong kong, got %#v", places)
+		}
+	})
+}
+
+func TestNamedArgs(t *testing.T) {
+	if NamedArgs("sqlserver") {
+		t.Fatal("expected named args to be off by default")
+	}
+	NamedArgsDriver("sqlserver", true)
+	defer NamedArgsDriver("sqlserver", false)
+
+	type loc struct {
+		City string `db:"city"`
+	}
+	var total int
+	arg := struct {
+		Country string  `db:"country"`
+		Loc     loc     `db:"loc"`
+		Codes   []int   `db:"codes"`
+		Total   sql.Out `db:"total"`
+	}{"x", loc{"y"}, []int{1, 2}, sql.Out{Dest: &total}}
+
+	q := `SELECT :total = COUNT(*) FROM place WHERE country = :country AND city = :loc.city AND (telcode IN (:codes) OR :country = '')`
+	bound, args, err := bindNamedDriver("sqlserver", q, arg, mapper(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `SELECT @total = COUNT(*) FROM place WHERE country = @country AND city = @loc_city AND (telcode IN (@codes_1, @codes_2) OR @country = '')`
+	if bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+	expectArgs := []interface{}{
+		sql.Named("total", sql.Out{Dest: &total}),
+		sql.Named("country", "x"),
+		sql.Named("loc_city", "y"),
+		sql.Named("codes_1", 1),
+		sql.Named("codes_2", 2),
+	}
+	if !reflect.DeepEqual(args, expectArgs) {
+		t.Errorf("expected %v, got %v", expectArgs, args)
+	}
+
+	// sql.NamedArg values are renamed to their param
+	m := map[string]interface{}{"a": sql.Named("other", 1)}
+	_, args, err = bindNamedDriver("sqlserver", `SELECT :a`, m, mapper(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []interface{}{sql.Named("a", 1)}; !reflect.DeepEqual(args, expect) {
+		t.Errorf("expected %v, got %v", expect, args)
+	}
+
+	// params can't share a sql.NamedArg
+	collide := map[string]interface{}{"a.b": 1, "a_b": 2, "c": []int{1, 2}, "c_1": 3}
+	for _, q := range []string{`SELECT :a.b, :a_b`, `SELECT :c_1 WHERE x IN (:c)`} {
+		if _, _, err := bindNamedDriver("sqlserver", q, collide, mapper(), nil); err == nil || !strings.Contains(err.Error(), "both bound") {
+			t.Errorf("%s: expected a collision error, got %v", q, err)
+		}
+	}
+	if _, err := compileNamedStmt("sqlserver", `SELECT :a.b, :a_b`); err == nil {
+		t.Error("expected a collision error compiling a statement")
+	}
+
+	// batches are still bound positionally
+	bound, _, err = bindNamedDriver("sqlserver", `INSERT INTO foo (a) VALUES (:a)`, []interface{}{m, m}, mapper(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `INSERT INTO foo (a) VALUES (@p1),(@p2)`; bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		if db.DriverName() != "sqlite3" {
+			return
+		}
+		NamedArgsDriver("sqlite3", true)
+		defer NamedArgsDriver("sqlite3", false)
+		loadDefaultFixture(db, t)
+
+		p := map[string]interface{}{"country": "Narnia", "city": "Cair Paravel", "telcode": 7}
+		_, err := db.NamedExec(`INSERT INTO place (country, city, telcode) VALUES (:country, :city, :telcode)`, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var places []Place
+		rows, err := db.NamedQuery(`SELECT * FROM place WHERE country = :country OR (telcode IN (:codes) AND :country != '') ORDER BY telcode`,
+			map[string]interface{}{"country": "Narnia", "codes": []int{1, 65}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var p Place
+			if err := rows.StructScan(&p); err != nil {
+				t.Fatal(err)
+			}
+			places = append(places, p)
+		}
+		if len(places) != 3 || places[0].TelCode != 1 || places[1].TelCode != 7 || places[2].TelCode != 65 {
+			t.Errorf("unexpected places %#v", places)
+		}
+
+		stmt, err := db.PrepareNamed(`SELECT telcode FROM place WHERE country = :country AND city = :city`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		if expect := `SELECT telcode FROM place WHERE country = :country AND city = :city`; stmt.QueryString != expect {
+			t.Errorf("expected %s, got %s", expect, stmt.QueryString)
+		}
+		var code int
+		if err := stmt.Get(&code, p); err != nil {
+			t.Fatal(err)
+		}
+		if code != 7 {
+			t.Errorf("expected 7, got %d", code)
+		}
+	})
+}
+
+func TestMergeArgs(t *testing.T) {
+	type user struct {
+		ID     int    `db:"id"`
+		Name   string `db:"name"`
+		Tenant int    `db:"tenant_id"`
+	}
+	u := &user{ID: 1, Name: "alice", Tenant: 2}
+	scope := map[string]interface{}{"tenant_id": 3, "now": "today"}
+	q := `UPDATE users SET name = :name, updated = :now WHERE id = :id AND tenant_id = :tenant_id`
+
+	table := []struct {
+		arg    interface{}
+		expect []interface{}
+	}{
+		{MergeArgs(scope, u), []interface{}{"alice", "today", 1, 3}},
+		{MergeArgs(u, scope), []interface{}{"alice", "today", 1, 2}},
+		{MergeArgs(map[string]interface{}{"name": "bob"}, *u, scope), []interface{}{"bob", "today", 1, 2}},
+	}
+	for _, test := range table {
+		bound, args, err := Named(q, test.arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := `UPDATE users SET name = ?, updated = ? WHERE id = ? AND tenant_id = ?`; bound != expect {
+			t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+		}
+		if !reflect.DeepEqual(args, test.expect) {
+			t.Errorf("expected %v, got %v", test.expect, args)
+		}
+	}
+
+	// the error lists the index and type of every source which was searched,
+	// but none of their values
+	_, _, err := Named(q, MergeArgs(u, map[string]interface{}{"tenant_id": 3}))
+	if err == nil {
+		t.Fatal("expected an error for a missing name")
+	}
+	msg := err.Error()
+	if expect := "could not find name now in any of the merged args 0 (*sqlx.user), 1 (map[string]interface {})"; msg != expect {
+		t.Errorf("expected %q, got %q", expect, msg)
+	}
+
+	// merged args can be batch elements
+	rows := []interface{}{MergeArgs(scope, user{ID: 1}), MergeArgs(scope, user{ID: 2})}
+	bound, args, err := Named(`INSERT INTO users (id, tenant_id) VALUES (:id, :tenant_id)`, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `INSERT INTO users (id, tenant_id) VALUES (?, ?),(?, ?)`; bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+	if expect := []interface{}{1, 3, 2, 3}; !reflect.DeepEqual(args, expect) {
+		t.Errorf("expected %v, got %v", expect, args)
+	}
+
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		p := Place{Country: "Narnia"}
+		_, err := db.NamedExec(`INSERT INTO place (country, telcode) VALUES (:country, :telcode)`,
+			MergeArgs(map[string]interface{}{"telcode": 7}, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stmt, err := db.PrepareNamed(`SELECT telcode FROM place WHERE country = :country AND telcode > :min`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		var code int
+		if err := stmt.Get(&code, MergeArgs(&p, map[string]interface{}{"min": 0})); err != nil {
+			t.Fatal(err)
+		}
+		if code != 7 {
+			t.Errorf("expected 7, got %d", code)
+		}
+	})
+}
+
+func TestOptionalNamedParams(t *testing.T) {
+	q := `UPDATE users SET name = COALESCE(:name?, name), status = :{status='active'}, n = :{n=10}::::int WHERE id = :id AND (:email? IS NULL OR email = :email?)`
+	table := []struct {
+		arg    interface{}
+		expect []interface{}
+	}{
+		{map[string]interface{}{"id": 1}, []interface{}{nil, "active", int64(10), 1, nil, nil}},
+		{map[string]interface{}{"id": 1, "name": "a", "status": "b", "n": 2, "email": "c"}, []interface{}{"a", "b", 2, 1, "c", "c"}},
+		{struct {
+			ID    int    `db:"id"`
+			Email string `db:"email"`
+		}{1, "c"}, []interface{}{nil, "active", int64(10), 1, "c", "c"}},
+		{MergeArgs(map[string]interface{}{"n": 3}, map[string]interface{}{"id": 1}), []interface{}{nil, "active", 3, 1, nil, nil}},
+	}
+	for _, test := range table {
+		bound, args, err := bindNamedMapper(DOLLAR, q, test.arg, mapper())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := `UPDATE users SET name = COALESCE($1, name), status = $2, n = $3::int WHERE id = $4 AND ($5 IS NULL OR email = $5)`
+		if bound != expect {
+			t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+		}
+		// the repeated :email? is only bound once
+		if e := test.expect[:len(test.expect)-1]; !reflect.DeepEqual(args, e) {
+			t.Errorf("expected %v, got %v", e, args)
+		}
+		_, args, err = bindNamedMapper(QUESTION, q, test.arg, mapper())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(args, test.expect) {
+			t.Errorf("expected %v, got %v", test.expect, args)
+		}
+	}
+
+	// required params are still required
+	if _, _, err := Named(q, map[string]interface{}{"name": "a"}); err == nil {
+		t.Error("expected an error for a missing required param")
+	}
+
+	for _, q := range []string{
+		`SELECT :{a=x}`,
+		`SELECT :{a=1}, :{a=2}`,
+		`SELECT :{a=1}, :a?`,
+		`SELECT :a:b`,
+	} {
+		if _, _, err := compileNamedQuery([]byte(q), QUESTION); err == nil {
+			t.Errorf("%s: expected an error", q)
+		}
+	}
+	// the same default can be repeated, and a name is optional if any of its
+	// params are
+	if _, _, err := compileNamedQuery([]byte(`SELECT :{a=1}, :{a=1}, :a, :{a}`), QUESTION); err != nil {
+		t.Error(err)
+	}
+
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		_, err := db.NamedExec(`INSERT INTO place (country, city, telcode) VALUES (:country, :city?, :{telcode=7})`,
+			[]map[string]interface{}{{"country": "Narnia"}, {"country": "Archenland", "telcode": 8}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stmt, err := db.PrepareNamed(`SELECT * FROM place WHERE country = :country AND (:city? IS NULL OR city = :city?)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		var places []Place
+		if err := stmt.Select(&places, map[string]interface{}{"country": "Narnia"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 1 || places[0].City.Valid || places[0].TelCode != 7 {
+			t.Errorf("unexpected places %#v", places)
+		}
+		places = nil
+		if err := stmt.Select(&places, map[string]interface{}{"country": "Archenland", "city": "Anvard"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 0 {
+			t.Errorf("unexpected places %#v", places)
+		}
+	})
+}
+
+func TestNamedPaths(t *testing.T) {
+	type address struct {
+		City string `db:"city"`
+	}
+	type user struct {
+		Name    string                 `db:"name"`
+		Address *address               `db:"address"`
+		Meta    map[string]interface{} `db:"meta"`
+	}
+
+	// a JSON decoded payload, with struct pointers and structs with maps mixed in
+	payload := map[string]interface{}{
+		"user": map[string]interface{}{
+			"address": map[string]interface{}{"city": "Paris"},
+			"tags":    map[string]string{"a.b": "dotted"},
+		},
+		"owner":    &user{Name: "alice", Address: &address{City: "Oslo"}, Meta: map[string]interface{}{"level": 3}},
+		"flat.key": 1,
+	}
+	q := `SELECT :user.address.city, :user.tags.a.b, :owner.name, :owner.address.city, :owner.meta.level, :flat.key`
+	bound, args, err := Named(q, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `SELECT ?, ?, ?, ?, ?, ?`; bound != expect {
+		t.Errorf("\nexpected: `%s`\ngot:      `%s`", expect, bound)
+	}
+	if expect := []interface{}{"Paris", "dotted", "alice", "Oslo", 3, 1}; !reflect.DeepEqual(args, expect) {
+		t.Errorf("expected %v, got %v", expect, args)
+	}
+
+	// maps inside of structs
+	_, args, err = Named(`SELECT :meta.level, :address.city`, user{Address: &address{City: "Rome"}, Meta: map[string]interface{}{"level": 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []interface{}{4, "Rome"}; !reflect.DeepEqual(args, expect) {
+		t.Errorf("expected %v, got %v", expect, args)
+	}
+
+	// missing values give the path which is missing
+	table := []struct {
+		q   string
+		arg interface{}
+		why string
+	}{
+		{`SELECT :user.phone.number`, payload, "user has no key phone"},
+		{`SELECT :owner.meta.level.x`, payload, "owner.meta.level is a int, not a struct or map"},
+		{`SELECT :owner.nickname.first`, payload, "owner has no field nickname"},
+		{`SELECT :meta.level`, user{}, "meta is nil"},
+		{`SELECT :owner.address.city`, map[string]interface{}{"owner": &user{}}, "owner.address is nil"},
+		{`SELECT :nobody.name`, map[string]interface{}{}, "the arg has no key nobody"},
+	}
+	for _, test := range table {
+		_, _, err := Named(test.q, test.arg)
+		if err == nil || !strings.HasSuffix(err.Error(), ": "+test.why) {
+			t.Errorf("%s: expected an error ending in %q, got %v", test.q, test.why, err)
+		}
+	}
+
+	// optional params and merged args fall back as usual
+	_, args, err = Named(`SELECT :user.phone?, :owner.address.city`, MergeArgs(map[string]interface{}{"owner": &user{}}, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []interface{}{nil, "Oslo"}; !reflect.DeepEqual(args, expect) {
+		t.Errorf("expected %v, got %v", expect, args)
+	}
+}
+
+func TestValidateNamed(t *testing.T) {
+	type address struct {
+		City string `db:"city"`
+	}
+	type user struct {
+		ID      int                    `db:"id"`
+		Email   string                 `db:"email"`
+		Address *address               `db:"address"`
+		Meta    map[string]interface{} `db:"meta"`
+		Extra   interface{}            `db:"extra"`
+	}
+	ut := reflect.TypeOf(user{})
+
+	valid := []string{
+		`SELECT * FROM users WHERE id = :id AND email = :email`,
+		`SELECT :address.city, :meta.anything.at.all, :extra.x, :missing?, :{other=1}`,
+		`SELECT ':nope', "a:b" -- :comment`,
+	}
+	for _, q := range valid {
+		if err := ValidateNamed(q, ut); err != nil {
+			t.Errorf("%s: %v", q, err)
+		}
+		if err := ValidateNamed(q, reflect.TypeOf(&user{})); err != nil {
+			t.Errorf("%s: %v", q, err)
+		}
+	}
+
+	// every missing name is reported at once
+	err := ValidateNamed(`UPDATE users SET email = :emial WHERE id = :id AND city = :address.town AND x = :id.x`, ut)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if expect := "could not find names emial, address.town, id.x in sqlx.user"; err.Error() != expect {
+		t.Errorf("expected %q, got %q", expect, err)
+	}
+	if err := ValidateNamed(`SELECT :a:b`, ut); err == nil {
+		t.Error("expected a parse error")
+	}
+	if err := ValidateNamed(`SELECT :a.b`, reflect.TypeOf(map[string]interface{}{})); err != nil {
+		t.Error(err)
+	}
+	var none interface{}
+	if err := ValidateNamed(`SELECT :a`, reflect.TypeOf(none)); err == nil {
+		t.Error("expected an error for a nil type")
+	}
+
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		stmt := db.MustPrepareNamedChecked(`SELECT * FROM place WHERE telcode = :telcode`, reflect.TypeOf(Place{}))
+		defer stmt.Close()
+		var p Place
+		if err := stmt.Get(&p, Place{TelCode: 65}); err != nil {
+			t.Fatal(err)
+		}
+		if p.Country != "Singapore" {
+			t.Errorf("expected Singapore, got %#v", p)
+		}
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected a panic for an unknown name")
+			}
+		}()
+		db.MustPrepareNamedChecked(`SELECT * FROM place WHERE telcode = :tel_code`, reflect.TypeOf(Place{}))
+	})
+}
@@ -31,6 +31,10 @@ type StructMap struct {
 	Index []*FieldInfo
 	Paths map[string]*FieldInfo
 	Names map[string]*FieldInfo
+	// Slices are the named fields which are slices of structs or of pointers
+	// to structs, in field order.  Their element types are not part of the
+	// map; use the Mapper to map them.
+	Slices []*FieldInfo
 }
 
 // GetByPath returns a *FieldInfo for a given string path.
@@ -438,6 +442,17 @@ QueueLoop:
 			}
 		}
 	}
+	for _, fi := range flds.Index {
+		if flds.Names[fi.Path] == fi && isStructSlice(fi.Field.Type) {
+			flds.Slices = append(flds.Slices, fi)
+		}
+	}
 
 	return flds
 }
+
+// isStructSlice returns whether t is a slice of structs or of pointers to
+// structs.
+func isStructSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && Deref(t.Elem()).Kind() == reflect.Struct
+}
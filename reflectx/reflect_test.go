@@ -510,6 +510,43 @@ func TestTagNameMapping(t *testing.T) {
 	}
 }
 
+func TestSliceFields(t *testing.T) {
+	type Review struct {
+		ID int
+	}
+	type Book struct {
+		ID      int
+		Reviews []*Review
+	}
+	type Meta struct {
+		Tags []Review
+	}
+	type Author struct {
+		ID    int
+		Books []Book `db:"books"`
+		Names []string
+		Data  []byte
+		Meta  Meta
+		Skip  []Book `db:"-"`
+	}
+
+	m := NewMapperFunc("db", strings.ToLower)
+	slices := m.TypeMap(reflect.TypeOf(Author{})).Slices
+	if len(slices) != 2 {
+		t.Fatalf("Expecting 2 slice fields, got %d", len(slices))
+	}
+	if slices[0].Path != "books" || slices[1].Path != "meta.tags" {
+		t.Errorf("Expecting books and meta.tags, got %s and %s", slices[0].Path, slices[1].Path)
+	}
+	if _, ok := m.TypeMap(reflect.TypeOf(Author{})).Names["books.id"]; ok {
+		t.Error("Expecting slice elements not to be mapped")
+	}
+	slices = m.TypeMap(reflect.TypeOf(Book{})).Slices
+	if len(slices) != 1 || slices[0].Path != "reviews" {
+		t.Errorf("Expecting reviews, got %v", slices)
+	}
+}
+
 func TestMapping(t *testing.T) {
 	type Person struct {
 		ID           int
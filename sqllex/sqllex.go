@@ -0,0 +1,539 @@
+// Package sqllex implements a small lexer for SQL queries.  It is not a parser
+// and does not validate the query;  its purpose is to split a query into tokens
+// well enough to tell bindvars and named parameters apart from text which looks
+// like them but is inside of a string literal, a quoted identifier, a comment
+// or a dollar-quoted string.  Concatenating the Text of every token returned
+// for a query reproduces that query exactly.
+package sqllex
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind is the kind of a Token.
+type Kind int
+
+// Token kinds returned by the Lexer.
+const (
+	EOF                Kind = iota
+	Space                   // whitespace
+	Word                    // unquoted identifier or keyword
+	Number                  // numeric literal
+	String                  // 'string literal'
+	QuotedIdent             // "identifier", `identifier` or [identifier]
+	LineComment             // -- comment (or # comment)
+	BlockComment            // /* comment */
+	DollarString            // $tag$ dollar-quoted string $tag$
+	Placeholder             // ?
+	EscapedPlaceholder      // ?? (a literal ?)
+	NamedParam              // :name, :name? or :{name=default}
+	DoubleColon             // ::
+	Operator                // punctuation and operators
+	Ordinal                 // $1 or @p1
+)
+
+var kindNames = [...]string{
+	EOF:                "EOF",
+	Space:              "Space",
+	Word:               "Word",
+	Number:             "Number",
+	String:             "String",
+	QuotedIdent:        "QuotedIdent",
+	LineComment:        "LineComment",
+	BlockComment:       "BlockComment",
+	DollarString:       "DollarString",
+	Placeholder:        "Placeholder",
+	EscapedPlaceholder: "EscapedPlaceholder",
+	NamedParam:         "NamedParam",
+	DoubleColon:        "DoubleColon",
+	Operator:           "Operator",
+	Ordinal:            "Ordinal",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Token is a lexical token of a query.  Text is the exact text of the token
+// as it appears in the query, and Pos is its byte offset in the query.
+type Token struct {
+	Kind Kind
+	Text string
+	Pos  int
+}
+
+// Name returns the name of a NamedParam token, which is its text without the
+// leading colon, and without the `?` of an optional `:name?` param or the
+// braces and default of a `:{name=default}` param.  It returns the empty string
+// for any other kind of token.
+func (t Token) Name() string {
+	if t.Kind != NamedParam {
+		return ""
+	}
+	name := t.Text[1:]
+	if name[0] == '{' {
+		name = name[1 : len(name)-1]
+		if i := strings.IndexByte(name, '='); i != -1 {
+			name = name[:i]
+		}
+		return name
+	}
+	return strings.TrimSuffix(name, "?")
+}
+
+// Optional returns whether the token is an optional `:name?` param or a
+// `:{name=default}` param with a default.
+func (t Token) Optional() bool {
+	if t.Kind != NamedParam {
+		return false
+	}
+	return strings.HasSuffix(t.Text, "?") || strings.HasPrefix(t.Text, ":{") && strings.IndexByte(t.Text, '=') != -1
+}
+
+// Default returns the default of a `:{name=default}` param as it is written
+// in the query.  It returns the empty string for any other token.
+func (t Token) Default() string {
+	if t.Kind != NamedParam || !strings.HasPrefix(t.Text, ":{") {
+		return ""
+	}
+	if i := strings.IndexByte(t.Text, '='); i != -1 {
+		return t.Text[i+1 : len(t.Text)-1]
+	}
+	return ""
+}
+
+// Index returns the number of an Ordinal token, which is 1 for `$1` or `@p1`.
+// It returns 0 for any other kind of token.
+func (t Token) Index() int {
+	if t.Kind != Ordinal {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimLeft(t.Text, "$@pP"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Literal returns whether the token is a string, quoted identifier, comment or
+// dollar-quoted string, whose contents are opaque to bindvar rewriting.
+func (t Token) Literal() bool {
+	switch t.Kind {
+	case String, QuotedIdent, LineComment, BlockComment, DollarString:
+		return true
+	}
+	return false
+}
+
+// A Dialect controls the lexical rules that vary between databases.
+type Dialect struct {
+	// BackslashEscapes allows backslash escapes in all string literals.
+	BackslashEscapes bool
+	// EscapeStrings allows backslash escapes in E'' string literals.
+	EscapeStrings bool
+	// DollarQuotes enables $tag$ dollar-quoted strings.
+	DollarQuotes bool
+	// BacktickIdents enables `quoted` identifiers.
+	BacktickIdents bool
+	// BracketIdents enables [quoted] identifiers.
+	BracketIdents bool
+	// NestedComments allows /* block comments */ to nest.
+	NestedComments bool
+	// HashComments enables # line comments.
+	HashComments bool
+	// JSONOperators makes ?| and ?& operators rather than a bindvar
+	// followed by an operator.
+	JSONOperators bool
+}
+
+// Dialects for common databases.  Generic is a permissive superset of the
+// rules which are unlikely to conflict with one another, and is used when the
+// database is not known.
+var (
+	Generic   = Dialect{DollarQuotes: true, BacktickIdents: true, JSONOperators: true}
+	Postgres  = Dialect{EscapeStrings: true, DollarQuotes: true, NestedComments: true, JSONOperators: true}
+	MySQL     = Dialect{BackslashEscapes: true, BacktickIdents: true, HashComments: true}
+	SQLite    = Dialect{BacktickIdents: true, BracketIdents: true}
+	SQLServer = Dialect{BracketIdents: true}
+	Oracle    = Dialect{}
+)
+
+// A Lexer splits a query into Tokens.
+type Lexer struct {
+	src     string
+	pos     int
+	dialect Dialect
+	err     error
+}
+
+// New returns a Lexer for query using the rules of dialect d.
+func New(query string, d Dialect) *Lexer {
+	return &Lexer{src: query, dialect: d}
+}
+
+// Tokenize returns all of the tokens in query, not including the final EOF.
+func Tokenize(query string, d Dialect) []Token {
+	var toks []Token
+	l := Lexer{src: query, dialect: d}
+	for t := l.Next(); t.Kind != EOF; t = l.Next() {
+		toks = append(toks, t)
+	}
+	return toks
+}
+
+// Err returns an error if the lexer has reached a string literal, quoted
+// identifier, block comment or dollar-quoted string which is not terminated.
+// The token returned for it runs to the end of the query.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// Next returns the next token in the query.  Once the query is exhausted, it
+// returns a token of kind EOF with empty Text.
+func (l *Lexer) Next() Token {
+	start := l.pos
+	if start >= len(l.src) {
+		return Token{Kind: EOF, Pos: start}
+	}
+	kind := l.scan()
+	return Token{Kind: kind, Text: l.src[start:l.pos], Pos: start}
+}
+
+// scan advances past the token at the current position and returns its kind.
+func (l *Lexer) scan() Kind {
+	src, i, d := l.src, l.pos, l.dialect
+	c := src[i]
+
+	switch {
+	case isSpace(c):
+		for i++; i < len(src) && isSpace(src[i]); i++ {
+		}
+		l.pos = i
+		return Space
+	case isDigit(c):
+		l.pos = scanNumber(src, i)
+		return Number
+	case (c == 'E' || c == 'e') && d.EscapeStrings && i+1 < len(src) && src[i+1] == '\'':
+		return l.end(scanQuoted(src, i+1, '\'', true), String)
+	case isIdentStart(c):
+		for i++; i < len(src) && isIdent(src[i]); i++ {
+		}
+		l.pos = i
+		return Word
+	}
+
+	switch c {
+	case '\'':
+		return l.end(scanQuoted(src, i, '\'', d.BackslashEscapes), String)
+	case '"':
+		return l.end(scanQuoted(src, i, '"', false), QuotedIdent)
+	case '`':
+		if d.BacktickIdents {
+			return l.end(scanQuoted(src, i, '`', false), QuotedIdent)
+		}
+	case '[':
+		if d.BracketIdents {
+			return l.end(scanQuoted(src, i, ']', false), QuotedIdent)
+		}
+	case '-':
+		if i+1 < len(src) && src[i+1] == '-' {
+			l.pos = scanLine(src, i)
+			return LineComment
+		}
+	case '#':
+		if d.HashComments {
+			l.pos = scanLine(src, i)
+			return LineComment
+		}
+	case '/':
+		if i+1 < len(src) && src[i+1] == '*' {
+			return l.end(scanBlockComment(src, i, d.NestedComments), BlockComment)
+		}
+	case '$':
+		if i+1 < len(src) && isDigit(src[i+1]) {
+			l.pos = scanDigits(src, i+1)
+			return Ordinal
+		}
+		if d.DollarQuotes {
+			if tag := dollarTag(src[i:]); tag != "" {
+				end := strings.Index(src[i+len(tag):], tag)
+				if end != -1 {
+					end = i + len(tag) + end + len(tag)
+				}
+				return l.end(end, DollarString)
+			}
+		}
+	case '@':
+		if i+2 < len(src) && (src[i+1] == 'p' || src[i+1] == 'P') && isDigit(src[i+2]) {
+			if end := scanDigits(src, i+2); end == len(src) || !isIdent(src[end]) {
+				l.pos = end
+				return Ordinal
+			}
+		}
+	case '?':
+		if i+1 < len(src) {
+			switch src[i+1] {
+			case '?':
+				l.pos = i + 2
+				return EscapedPlaceholder
+			case '|', '&':
+				// `?||` is a bindvar followed by the concat operator
+				if d.JSONOperators && (src[i+1] == '&' || i+2 >= len(src) || src[i+2] != '|') {
+					l.pos = i + 2
+					return Operator
+				}
+			}
+		}
+		l.pos = i + 1
+		return Placeholder
+	case ':':
+		if i+1 < len(src) {
+			switch n := src[i+1]; {
+			case n == ':':
+				l.pos = i + 2
+				return DoubleColon
+			case n == '=':
+				l.pos = i + 2
+				return Operator
+			case n == '{':
+				if end := scanBraced(src, i+2); end != -1 {
+					l.pos = end
+					return NamedParam
+				}
+			default:
+				if end := scanName(src, i+1); end > i+1 {
+					l.pos = scanOptional(src, end, d)
+					return NamedParam
+				}
+			}
+		}
+	}
+
+	l.pos = i + 1
+	return Operator
+}
+
+// end advances past the token of kind ending at end and returns kind.  An end
+// of -1 is a token which is not terminated, which runs to the end of the query
+// and sets the error returned by Err.
+func (l *Lexer) end(end int, kind Kind) Kind {
+	if end == -1 {
+		if l.err == nil {
+			l.err = fmt.Errorf("sqllex: unterminated %s at %d", literalNames[kind], l.pos)
+		}
+		end = len(l.src)
+	}
+	l.pos = end
+	return kind
+}
+
+var literalNames = map[Kind]string{
+	String:       "string literal",
+	QuotedIdent:  "quoted identifier",
+	BlockComment: "block comment",
+	DollarString: "dollar-quoted string",
+}
+
+// scanQuoted returns the position after the quoted string or identifier opened
+// at i and closed by the quote byte.  Doubled quotes are an escaped quote, and
+// if backslash is true, so is a quote preceded by a backslash.  It returns -1
+// if the string is not terminated.
+func scanQuoted(src string, i int, quote byte, backslash bool) int {
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if i+1 < len(src) && src[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// scanLine returns the position of the newline ending the line comment at i.
+func scanLine(src string, i int) int {
+	if end := strings.IndexByte(src[i:], '\n'); end != -1 {
+		return i + end
+	}
+	return len(src)
+}
+
+// scanBlockComment returns the position after the block comment opened at i,
+// or -1 if it is not terminated.
+func scanBlockComment(src string, i int, nested bool) int {
+	depth := 0
+	for i < len(src)-1 {
+		switch {
+		case src[i] == '/' && src[i+1] == '*':
+			if depth == 0 || nested {
+				depth++
+			}
+			i += 2
+		case src[i] == '*' && src[i+1] == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// scanNumber returns the position after the numeric literal starting at i.
+func scanNumber(src string, i int) int {
+	for ; i < len(src) && isDigit(src[i]); i++ {
+	}
+	if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+		for i++; i < len(src) && isDigit(src[i]); i++ {
+		}
+	}
+	if i+1 < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if src[j] == '+' || src[j] == '-' {
+			j++
+		}
+		if j < len(src) && isDigit(src[j]) {
+			for i = j; i < len(src) && isDigit(src[i]); i++ {
+			}
+		}
+	}
+	return i
+}
+
+// scanDigits returns the position after the digits starting at i.
+func scanDigits(src string, i int) int {
+	for ; i < len(src) && isDigit(src[i]); i++ {
+	}
+	return i
+}
+
+// dollarTag returns the `$tag$` delimiter which opens a dollar-quoted string
+// at the start of s, or the empty string if s does not start with one.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1]
+		case isDigit(c):
+			if i == 1 {
+				return ""
+			}
+		case !isIdentStart(c):
+			return ""
+		}
+	}
+	return ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
+
+// scanName returns the position after the named parameter name starting at i,
+// or i if there isn't one.  Names can contain unicode letters and digits,
+// underscores and periods.
+func scanName(src string, i int) int {
+	for i < len(src) {
+		if c := src[i]; c < utf8.RuneSelf {
+			if !isNameByte(c) {
+				break
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(src[i:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// scanOptional returns the position after the `?` which makes the named param
+// ending at i optional, or i if there isn't one.  A `??` or a `?|` or `?&`
+// operator after a param is not taken to be its `?`, though `?||` is.
+func scanOptional(src string, i int, d Dialect) int {
+	if i >= len(src) || src[i] != '?' {
+		return i
+	}
+	if i+1 < len(src) {
+		switch src[i+1] {
+		case '?':
+			return i
+		case '&':
+			if d.JSONOperators {
+				return i
+			}
+		case '|':
+			if d.JSONOperators && (i+2 >= len(src) || src[i+2] != '|') {
+				return i
+			}
+		}
+	}
+	return i + 1
+}
+
+// scanBraced returns the position after the `:{name}` or `:{name=default}`
+// param whose name starts at i, or -1 if there isn't one.  The default is a
+// 'quoted string' or a run of characters up to the closing brace which does
+// not contain any spaces or quotes.
+func scanBraced(src string, i int) int {
+	end := scanName(src, i)
+	if end == i || end >= len(src) {
+		return -1
+	}
+	if src[end] == '=' {
+		j := end + 1
+		if j < len(src) && src[j] == '\'' {
+			if j = scanQuoted(src, j, '\'', false); j == -1 {
+				return -1
+			}
+		} else {
+			for ; j < len(src) && src[j] != '}' && src[j] != '\'' && !isSpace(src[j]); j++ {
+			}
+		}
+		if j == end+1 {
+			return -1
+		}
+		end = j
+	}
+	if end < len(src) && src[end] == '}' {
+		return end + 1
+	}
+	return -1
+}
+
+// isNameByte returns whether the ASCII character c can be part of a name.
+func isNameByte(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c)
+}
@@ -0,0 +1,187 @@
+package sqllex
+
+import (
+	"strings"
+	"testing"
+)
+
+func kinds(toks []Token) []Kind {
+	ks := make([]Kind, 0, len(toks))
+	for _, t := range toks {
+		ks = append(ks, t.Kind)
+	}
+	return ks
+}
+
+func TestTokenize(t *testing.T) {
+	table := []struct {
+		q     string
+		d     Dialect
+		kinds []Kind
+	}{
+		{`a = ?`, Generic, []Kind{Word, Space, Operator, Space, Placeholder}},
+		{`a=:name`, Generic, []Kind{Word, Operator, NamedParam}},
+		{`a::text`, Generic, []Kind{Word, DoubleColon, Word}},
+		{`@a:=1.5e3`, Generic, []Kind{Operator, Word, Operator, Number}},
+		{`'it''s ?'`, Generic, []Kind{String}},
+		{`'it\'s' ?`, MySQL, []Kind{String, Space, Placeholder}},
+		{`'C:\' ?`, Postgres, []Kind{String, Space, Placeholder}},
+		{`E'\'?' ?`, Postgres, []Kind{String, Space, Placeholder}},
+		{`"a?"` + "`b?`", Generic, []Kind{QuotedIdent, QuotedIdent}},
+		{"`b?`", Postgres, []Kind{Operator, Word, Placeholder, Operator}},
+		{`[a?]`, SQLServer, []Kind{QuotedIdent}},
+		{`a[?]`, Postgres, []Kind{Word, Operator, Placeholder, Operator}},
+		{"-- ?\n?", Generic, []Kind{LineComment, Space, Placeholder}},
+		{"# ?\n?", MySQL, []Kind{LineComment, Space, Placeholder}},
+		{`/* ? */?`, Generic, []Kind{BlockComment, Placeholder}},
+		{`/* /* ? */ ? */?`, Postgres, []Kind{BlockComment, Placeholder}},
+		{`/* /* ? */?`, MySQL, []Kind{BlockComment, Placeholder}},
+		{`$$ ? $$ $a$ ?$$ $a$ ?`, Postgres, []Kind{DollarString, Space, DollarString, Space, Placeholder}},
+		{`$1 $12a`, Postgres, []Kind{Ordinal, Space, Ordinal, Word}},
+		{`@p1 @P2 @p3x @param`, SQLServer, []Kind{Ordinal, Space, Ordinal, Space, Operator, Word, Space, Operator, Word}},
+		{`?? ?| ?& ?||`, Generic, []Kind{EscapedPlaceholder, Space, Operator, Space, Operator, Space, Placeholder, Operator, Operator}},
+		{`?|`, MySQL, []Kind{Placeholder, Operator}},
+		{`'unterminated ?`, Generic, []Kind{String}},
+	}
+
+	for _, test := range table {
+		toks := Tokenize(test.q, test.d)
+		got := kinds(toks)
+		if len(got) != len(test.kinds) {
+			t.Errorf("%q: expected %v, got %v", test.q, test.kinds, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.kinds[i] {
+				t.Errorf("%q: expected %v, got %v", test.q, test.kinds, got)
+				break
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	queries := []string{
+		`SELECT * FROM foo WHERE a = ? AND b = 'what?' -- comment`,
+		`INSERT INTO foo (a, b) VALUES (:a, :b) ON CONFLICT (a) DO UPDATE SET b = :b`,
+		`CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1::int; $body$ LANGUAGE sql`,
+		"SELECT `a`, [b], \"c\" /* unterminated",
+		`SELECT 名前, :名前 FROM テーブル`,
+	}
+	dialects := []Dialect{Generic, Postgres, MySQL, SQLite, SQLServer, Oracle}
+
+	for _, q := range queries {
+		for _, d := range dialects {
+			var b strings.Builder
+			pos := 0
+			for _, tok := range Tokenize(q, d) {
+				if tok.Pos != pos {
+					t.Errorf("%q: expected token at %d, got %d", q, pos, tok.Pos)
+				}
+				pos += len(tok.Text)
+				b.WriteString(tok.Text)
+			}
+			if b.String() != q {
+				t.Errorf("expected %q, got %q", q, b.String())
+			}
+		}
+	}
+}
+
+func TestOrdinals(t *testing.T) {
+	var got []int
+	for _, tok := range Tokenize(`SELECT $2, @p10, '$3', $1::int`, Generic) {
+		if tok.Kind == Ordinal {
+			got = append(got, tok.Index())
+		}
+	}
+	if len(got) != 3 || got[0] != 2 || got[1] != 10 || got[2] != 1 {
+		t.Errorf("expected [2 10 1], got %v", got)
+	}
+}
+
+func TestNamedParams(t *testing.T) {
+	table := []struct {
+		q     string
+		names string
+	}{
+		{`SELECT :a, ':b', "c:d", :e.f_1 -- :g`, "a,e.f_1"},
+		{`SELECT :名前, :café,:ｘ２ FROM テーブル`, "名前,café,ｘ２"},
+		{`SELECT :a→b, :€`, "a"},
+		{`SELECT :a?, :{b}c, :{d=1}, :{e='}'}, :{f} g, :{h=}, :{i j}`, "a,b,d,e,f"},
+	}
+	for _, test := range table {
+		var names []string
+		l := New(test.q, Generic)
+		for tok := l.Next(); tok.Kind != EOF; tok = l.Next() {
+			if tok.Kind == NamedParam {
+				names = append(names, tok.Name())
+			}
+		}
+		if strings.Join(names, ",") != test.names {
+			t.Errorf("%s: expected [%s], got %v", test.q, test.names, names)
+		}
+	}
+}
+
+func TestOptionalParams(t *testing.T) {
+	table := []struct {
+		q        string
+		d        Dialect
+		text     string
+		optional bool
+		def      string
+	}{
+		{`:a`, Generic, `:a`, false, ``},
+		{`:a?`, Generic, `:a?`, true, ``},
+		{`:a? IS NULL`, Generic, `:a?`, true, ``},
+		{`:a?::::int`, Generic, `:a?`, true, ``},
+		{`:a??`, Generic, `:a`, false, ``},
+		{`:a?|'{b}'`, Postgres, `:a`, false, ``},
+		{`:a?&'{b}'`, Postgres, `:a`, false, ``},
+		{`:a?||'b'`, Postgres, `:a?`, true, ``},
+		{`:a?|'{b}'`, MySQL, `:a?`, true, ``},
+		{`:{a}`, Generic, `:{a}`, false, ``},
+		{`:{a=10}`, Generic, `:{a=10}`, true, `10`},
+		{`:{a=-1.5}::::int`, Generic, `:{a=-1.5}`, true, `-1.5`},
+		{`:{a.b='it''s }'}`, Generic, `:{a.b='it''s }'}`, true, `'it''s }'`},
+		{`:{a=NULL})`, Generic, `:{a=NULL}`, true, `NULL`},
+	}
+	for _, test := range table {
+		tok := New(test.q, test.d).Next()
+		if tok.Kind != NamedParam || tok.Text != test.text {
+			t.Errorf("%s: expected NamedParam %s, got %v %s", test.q, test.text, tok.Kind, tok.Text)
+			continue
+		}
+		if tok.Optional() != test.optional || tok.Default() != test.def {
+			t.Errorf("%s: expected optional %v with default %q, got %v %q", test.q, test.optional, test.def, tok.Optional(), tok.Default())
+		}
+	}
+}
+
+func TestUnterminated(t *testing.T) {
+	table := []struct {
+		q   string
+		d   Dialect
+		err bool
+	}{
+		{`SELECT 'a', "b", /* c */ $$d$$`, Postgres, false},
+		{`SELECT 'O\'Brien', ?`, MySQL, false},
+		{`SELECT 'O\'Brien', ?`, Generic, true},
+		{`SELECT 'a`, Generic, true},
+		{`SELECT "a`, Generic, true},
+		{"SELECT `a", MySQL, true},
+		{`SELECT [a`, SQLServer, true},
+		{`SELECT /* a`, Generic, true},
+		{`SELECT $a$ b`, Postgres, true},
+		{`SELECT :{a='b}`, Generic, true},
+	}
+	for _, test := range table {
+		l := New(test.q, test.d)
+		for tok := l.Next(); tok.Kind != EOF; tok = l.Next() {
+		}
+		if err := l.Err(); (err != nil) != test.err {
+			t.Errorf("%s: expected an error %v, got %v", test.q, test.err, err)
+		}
+	}
+}
@@ -143,6 +143,24 @@ func isUnsafe(i interface{}) bool {
 	}
 }
 
+// inOptionsFor returns the options for In and SelectIn of i, which are set on
+// a DB with InArrays, SplitIn and EmptySlices and are inherited by the sqlx.Tx
+// and sqlx.Conn created from it.  Anything else uses the defaults.
+func inOptionsFor(i interface{}) inOptions {
+	switch i := i.(type) {
+	case DB:
+		return i.inOpts
+	case *DB:
+		return i.inOpts
+	case Tx:
+		return i.inOpts
+	case *Tx:
+		return i.inOpts
+	default:
+		return inOptions{}
+	}
+}
+
 func mapperFor(i interface{}) *reflectx.Mapper {
 	switch i := i.(type) {
 	case DB:
@@ -160,7 +178,6 @@ func mapperFor(i interface{}) *reflectx.Mapper {
 
 var _scannerInterface = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
 
-//lint:ignore U1000 ignoring this for now
 var _valuerInterface = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
 
 // Row is a reimplementation of sql.Row in order to gain access to the underlying
@@ -175,6 +192,12 @@ type Row struct {
 // Scan is a fixed implementation of sql.Row.Scan, which does not discard the
 // underlying error from the internal rows object if it exists.
 func (r *Row) Scan(dest ...interface{}) error {
+	return r.scan(dest, nil)
+}
+
+// scan is Scan, calling after, if it isn't nil, once dest is scanned and
+// before the rows are closed, so that it can scan the row again.
+func (r *Row) scan(dest []interface{}, after func() error) error {
 	if r.err != nil {
 		return r.err
 	}
@@ -209,6 +232,11 @@ func (r *Row) Scan(dest ...interface{}) error {
 	if err != nil {
 		return err
 	}
+	if after != nil {
+		if err := after(); err != nil {
+			return err
+		}
+	}
 	// Make sure the query can be processed to completion with no errors.
 	if err := r.rows.Close(); err != nil {
 		return err
@@ -245,6 +273,8 @@ type DB struct {
 	driverName string
 	unsafe     bool
 	Mapper     *reflectx.Mapper
+	inOpts     inOptions
+	cache      *QueryCache
 }
 
 // NewDb returns a new sqlx DB wrapper for a pre-existing *sql.DB.  The
@@ -286,7 +316,13 @@ func (db *DB) MapperFunc(mf func(string) string) {
 
 // Rebind transforms a query from QUESTION to the DB driver's bindvar type.
 func (db *DB) Rebind(query string) string {
-	return Rebind(BindType(db.driverName), query)
+	return db.cache.rebind(BindType(db.driverName), query)
+}
+
+// RebindFrom transforms a query from bindType to the DB driver's bindvar type,
+// reordering and repeating args as needed.  See sqlx.RebindFrom.
+func (db *DB) RebindFrom(bindType int, query string, args ...interface{}) (string, []interface{}, error) {
+	return RebindFrom(bindType, BindType(db.driverName), query, args...)
 }
 
 // Unsafe returns a version of DB which will silently succeed to scan when
@@ -294,12 +330,59 @@ func (db *DB) Rebind(query string) string {
 // sqlx.Stmt and sqlx.Tx which are created from this DB will inherit its
 // safety behavior.
 func (db *DB) Unsafe() *DB {
-	return &DB{DB: db.DB, driverName: db.driverName, unsafe: true, Mapper: db.Mapper}
+	return &DB{DB: db.DB, driverName: db.driverName, unsafe: true, Mapper: db.Mapper, inOpts: db.inOpts, cache: db.cache}
+}
+
+// InArrays returns a version of DB whose In binds a slice which is the only
+// bindvar in an `IN (?)` or `NOT IN (?)` list as a single array argument,
+// rewriting the predicate to `= ANY(?)` or `<> ALL(?)`.  This keeps both the
+// number of bindvars and the query text the same for any length of slice.
+// It only has an effect for drivers with the DOLLAR bindtype.
+func (db *DB) InArrays() *DB {
+	r := *db
+	r.inOpts.arrays = true
+	return &r
+}
+
+// SplitIn returns a version of DB whose SelectIn splits queries which would
+// have more bindvars than the BindLimit of the driver into several queries if
+// split is true, which is the default, or passes them to the driver as they
+// are if it is false.  See SelectIn for which queries can be split.
+func (db *DB) SplitIn(split bool) *DB {
+	r := *db
+	r.inOpts.noSplit = !split
+	return &r
+}
+
+// EmptySlices returns a version of DB whose In and SelectIn handle empty slices
+// according to policy.  By default, they return ErrEmptySlice.
+func (db *DB) EmptySlices(policy EmptySlicePolicy) *DB {
+	r := *db
+	r.inOpts.empty = policy
+	return &r
+}
+
+// CacheQueries returns a version of DB which caches compiled named queries and
+// rebound queries in c, or which doesn't cache them if c is nil.  sqlx.Tx and
+// sqlx.Conn which are created from this DB will share the cache.
+func (db *DB) CacheQueries(c *QueryCache) *DB {
+	r := *db
+	r.cache = c
+	return &r
+}
+
+// In expands slice values in args like In, returning a query which uses the
+// DB driver's bindvar type.
+func (db *DB) In(query string, args ...interface{}) (string, []interface{}, error) {
+	return bindIn(db.driverName, db.inOpts, query, args)
 }
 
 // BindNamed binds a query using the DB driver's bindvar type.
+// If arg is a slice or array, the query is bound as a batch insert, whose
+// params outside of the VALUES list are bound once to its first element;  see
+// NamedExec.
 func (db *DB) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
-	return bindNamedMapper(BindType(db.driverName), query, arg, db.Mapper)
+	return bindNamedCache(BindType(db.driverName), driverDialect(db.driverName), query, arg, db.Mapper, db.cache)
 }
 
 // NamedQuery using this DB.
@@ -320,6 +403,12 @@ func (db *DB) Select(dest interface{}, query string, args ...interface{}) error
 	return Select(db, dest, query, args...)
 }
 
+// SelectIn using this DB.
+// Slice values in args are expanded as with In.
+func (db *DB) SelectIn(dest interface{}, query string, args ...interface{}) error {
+	return SelectIn(db, dest, query, args...)
+}
+
 // Get using this DB.
 // Any placeholder parameters are replaced with supplied args.
 // An error is returned if the result set is empty.
@@ -343,7 +432,7 @@ func (db *DB) Beginx() (*Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{Tx: tx, driverName: db.driverName, unsafe: db.unsafe, Mapper: db.Mapper}, err
+	return &Tx{Tx: tx, driverName: db.driverName, unsafe: db.unsafe, Mapper: db.Mapper, inOpts: db.inOpts, cache: db.cache}, err
 }
 
 // Queryx queries the database and returns an *sqlx.Rows.
@@ -379,12 +468,29 @@ func (db *DB) PrepareNamed(query string) (*NamedStmt, error) {
 	return prepareNamed(db, query)
 }
 
+// MustPrepareNamedChecked prepares a NamedStmt after checking with ValidateNamed
+// that its params can be bound from values of type t, using the DB's mapper.
+// It panics if the query is invalid or can't be prepared, and is meant to be
+// used for queries prepared at startup, for instance in init().
+func (db *DB) MustPrepareNamedChecked(query string, t reflect.Type) *NamedStmt {
+	if err := validateNamed(db.Mapper, driverDialect(db.driverName), query, t); err != nil {
+		panic(err)
+	}
+	stmt, err := prepareNamed(db, query)
+	if err != nil {
+		panic(err)
+	}
+	return stmt
+}
+
 // Conn is a wrapper around sql.Conn with extra functionality
 type Conn struct {
 	*sql.Conn
 	driverName string
 	unsafe     bool
 	Mapper     *reflectx.Mapper
+	inOpts     inOptions
+	cache      *QueryCache
 }
 
 // Tx is an sqlx wrapper around sql.Tx with extra functionality
@@ -393,6 +499,8 @@ type Tx struct {
 	driverName string
 	unsafe     bool
 	Mapper     *reflectx.Mapper
+	inOpts     inOptions
+	cache      *QueryCache
 }
 
 // DriverName returns the driverName used by the DB which began this transaction.
@@ -402,18 +510,58 @@ func (tx *Tx) DriverName() string {
 
 // Rebind a query within a transaction's bindvar type.
 func (tx *Tx) Rebind(query string) string {
-	return Rebind(BindType(tx.driverName), query)
+	return tx.cache.rebind(BindType(tx.driverName), query)
+}
+
+// RebindFrom transforms a query from bindType to the transaction's bindvar type,
+// reordering and repeating args as needed.  See sqlx.RebindFrom.
+func (tx *Tx) RebindFrom(bindType int, query string, args ...interface{}) (string, []interface{}, error) {
+	return RebindFrom(bindType, BindType(tx.driverName), query, args...)
 }
 
 // Unsafe returns a version of Tx which will silently succeed to scan when
 // columns in the SQL result have no fields in the destination struct.
 func (tx *Tx) Unsafe() *Tx {
-	return &Tx{Tx: tx.Tx, driverName: tx.driverName, unsafe: true, Mapper: tx.Mapper}
+	return &Tx{Tx: tx.Tx, driverName: tx.driverName, unsafe: true, Mapper: tx.Mapper, inOpts: tx.inOpts, cache: tx.cache}
+}
+
+// InArrays returns a version of Tx whose In binds slices in `IN (?)` lists as
+// a single array argument.  See DB.InArrays.
+func (tx *Tx) InArrays() *Tx {
+	r := *tx
+	r.inOpts.arrays = true
+	return &r
+}
+
+// SplitIn returns a version of Tx whose SelectIn splits queries which would
+// have more bindvars than the BindLimit of the driver if split is true.  See
+// DB.SplitIn.
+func (tx *Tx) SplitIn(split bool) *Tx {
+	r := *tx
+	r.inOpts.noSplit = !split
+	return &r
+}
+
+// EmptySlices returns a version of Tx whose In and SelectIn handle empty slices
+// according to policy.
+func (tx *Tx) EmptySlices(policy EmptySlicePolicy) *Tx {
+	r := *tx
+	r.inOpts.empty = policy
+	return &r
+}
+
+// In expands slice values in args like In, returning a query which uses the
+// transaction's bindvar type.
+func (tx *Tx) In(query string, args ...interface{}) (string, []interface{}, error) {
+	return bindIn(tx.driverName, tx.inOpts, query, args)
 }
 
 // BindNamed binds a query within a transaction's bindvar type.
+// If arg is a slice or array, the query is bound as a batch insert, whose
+// params outside of the VALUES list are bound once to its first element;  see
+// NamedExec.
 func (tx *Tx) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
-	return bindNamedMapper(BindType(tx.driverName), query, arg, tx.Mapper)
+	return bindNamedCache(BindType(tx.driverName), driverDialect(tx.driverName), query, arg, tx.Mapper, tx.cache)
 }
 
 // NamedQuery within a transaction.
@@ -434,6 +582,12 @@ func (tx *Tx) Select(dest interface{}, query string, args ...interface{}) error
 	return Select(tx, dest, query, args...)
 }
 
+// SelectIn within a transaction.
+// Slice values in args are expanded as with In.
+func (tx *Tx) SelectIn(dest interface{}, query string, args ...interface{}) error {
+	return SelectIn(tx, dest, query, args...)
+}
+
 // Queryx within a transaction.
 // Any placeholder parameters are replaced with supplied args.
 func (tx *Tx) Queryx(query string, args ...interface{}) (*Rows, error) {
@@ -492,6 +646,8 @@ func (tx *Tx) NamedStmt(stmt *NamedStmt) *NamedStmt {
 		QueryString: stmt.QueryString,
 		Params:      stmt.Params,
 		Stmt:        tx.Stmtx(stmt.Stmt),
+		native:      stmt.native,
+		defaults:    stmt.defaults,
 	}
 }
 
@@ -582,6 +738,7 @@ type Rows struct {
 	started bool
 	fields  [][]int
 	values  []interface{}
+	nested  *nestedPtrs
 }
 
 // SliceScan using this Rows.
@@ -599,6 +756,7 @@ func (r *Rows) MapScan(dest map[string]interface{}) error {
 // prohibitive.  *Rows.StructScan caches the reflect work of matching up column
 // positions to fields to avoid that overhead per scan, which means it is not safe
 // to run StructScan on the same Rows instance with different struct types.
+// A pointer to a nested struct is left nil if every column under it is NULL.
 func (r *Rows) StructScan(dest interface{}) error {
 	v := reflect.ValueOf(dest)
 
@@ -621,6 +779,8 @@ func (r *Rows) StructScan(dest interface{}) error {
 			return fmt.Errorf("missing destination name %s in %T", columns[f], dest)
 		}
 		r.values = make([]interface{}, len(columns))
+		r.nested = newNestedPtrs(v.Type(), r.fields)
+		r.fields = r.nested.direct(r.fields)
 		r.started = true
 	}
 
@@ -628,11 +788,15 @@ func (r *Rows) StructScan(dest interface{}) error {
 	if err != nil {
 		return err
 	}
+	r.nested.prepare(r.values)
 	// scan into the struct field pointers and append to our results
 	err = r.Scan(r.values...)
 	if err != nil {
 		return err
 	}
+	if err = r.nested.set(v, r.values, r.Scan); err != nil {
+		return err
+	}
 	return r.Err()
 }
 
@@ -671,6 +835,19 @@ func Preparex(p Preparer, query string) (*Stmt, error) {
 // Select executes a query using the provided Queryer, and StructScans each row
 // into dest, which must be a slice.  If the slice elements are scannable, then
 // the result set must have only one column.  Otherwise, StructScan is used.
+// dest can also be a map keyed by a column, or a MapDest;  see MapDest.
+//
+// If some columns are named after a field which is a slice of structs, as in
+// "books.title" for a field `db:"books"`, the rows are those of a join and
+// are grouped into one struct for each value of its pk fields, tagged like
+// `db:"id,pk"`, with the rows of each struct in the slice filling that slice
+// the same way.  Slices of slices are grouped too, as deep as the columns go.
+// In this mode NULL leaves a field at its zero value, and a struct of a slice
+// whose pk is NULL, as in the rows of an outer join, is left out.
+//
+// A pointer to a nested struct, like a field Manager *Person for columns
+// "manager.name", is left nil if every column under it is NULL.
+//
 // The *sql.Rows are closed automatically.
 // Any placeholder parameters are replaced with supplied args.
 func Select(q Queryer, dest interface{}, query string, args ...interface{}) error {
@@ -683,6 +860,133 @@ func Select(q Queryer, dest interface{}, query string, args ...interface{}) erro
 	return scanAll(rows, dest, false)
 }
 
+// SelectIn is like Select, but first expands slice values in args as In does
+// and rebinds the query from `?` to the bindvar type of q.  If q is a DB or Tx
+// whose EmptySlices policy is EmptySliceNoRows, an empty slice in args sets
+// dest to an empty slice or map without running the query.
+//
+// If the expanded query would have more bindvars than the BindLimit of the
+// driver, and q isn't a DB or Tx with SplitIn(false), the largest slice is
+// split into chunks, the query is run once for each chunk and the rows are
+// appended to dest, or merged into it if it's a map, where a key repeated across chunks is
+// grouped or is an error as it is for a single query.  This is only done for a
+// slice in an `IN (?)` list at the top level of a query without aggregates,
+// DISTINCT, GROUP BY, ORDER BY, LIMIT, OFFSET, FETCH, window functions or set
+// operations at its top level, whose rows would be different if it were split;
+// other queries return an error instead.
+func SelectIn(q Ext, dest interface{}, query string, args ...interface{}) error {
+	return selectIn(q.DriverName(), inOptionsFor(q), dest, query, args, func(dest interface{}, query string, args []interface{}) error {
+		return Select(q, dest, query, args...)
+	})
+}
+
+// selectIn expands args and runs sel for each chunk of them, appending the
+// results to dest.  See SelectIn.
+func selectIn(driverName string, opts inOptions, dest interface{}, query string, args []interface{}, sel func(dest interface{}, query string, args []interface{}) error) error {
+	chunks, err := chunkIn(driverName, opts, query, args, BindLimit(driverName))
+	if err == ErrEmptySlice && opts.empty == EmptySliceNoRows {
+		_, err := resetDest(dest)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(chunks) == 1 {
+		query, args, err := bindIn(driverName, opts, query, chunks[0])
+		if err != nil {
+			return err
+		}
+		return sel(dest, query, args)
+	}
+
+	direct, err := resetDest(dest)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		query, args, err := bindIn(driverName, opts, query, chunk)
+		if err != nil {
+			return err
+		}
+		rows := reflect.New(direct.Type())
+		chunkDest := rows.Interface()
+		if d, ok := mapDest(dest); ok {
+			d.Dest = chunkDest
+			chunkDest = d
+		}
+		if err := sel(chunkDest, query, args); err != nil {
+			return err
+		}
+		if err := mergeDest(direct, rows.Elem(), dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapDest returns dest as a MapDest if it is one.
+func mapDest(dest interface{}) (MapDest, bool) {
+	switch d := dest.(type) {
+	case MapDest:
+		return d, true
+	case *MapDest:
+		return *d, true
+	}
+	return MapDest{}, false
+}
+
+// resetDest sets the slice or map dest points to, or that of a MapDest, to
+// an empty one, the same as Select would for a query which returned no rows,
+// and returns it.
+func resetDest(dest interface{}) (reflect.Value, error) {
+	if d, ok := mapDest(dest); ok {
+		dest = d.Dest
+	}
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr {
+		return value, errors.New("must pass a pointer, not a value, to StructScan destination")
+	}
+	if value.IsNil() {
+		return value, errors.New("nil pointer passed to StructScan destination")
+	}
+	direct := reflect.Indirect(value)
+	switch direct.Kind() {
+	case reflect.Slice:
+		direct.SetLen(0)
+	case reflect.Map:
+		direct.Set(reflect.MakeMap(direct.Type()))
+	default:
+		return direct, fmt.Errorf("expected slice or map but got %s", direct.Kind())
+	}
+	return direct, nil
+}
+
+// mergeDest adds the rows of a chunk of SelectIn to direct, the slice or map
+// that dest points to.  Rows with the same key are grouped or repeated in a
+// map as they are by Select.
+func mergeDest(direct, rows reflect.Value, dest interface{}) error {
+	if direct.Kind() == reflect.Slice {
+		direct.Set(reflect.AppendSlice(direct, rows))
+		return nil
+	}
+	d, _ := mapDest(dest)
+	grouped := groupsRows(direct.Type().Elem())
+	iter := rows.MapRange()
+	for iter.Next() {
+		k, v := iter.Key(), iter.Value()
+		old := direct.MapIndex(k)
+		switch {
+		case grouped && old.IsValid():
+			v = reflect.AppendSlice(old, v)
+		case old.IsValid() && !d.LastWins:
+			return fmt.Errorf("duplicate key %v", k.Interface())
+		}
+		direct.SetMapIndex(k, v)
+	}
+	return nil
+}
+
 // Get does a QueryRow using the provided Queryer, and scans the resulting row
 // to dest.  If dest is scannable, the result must only have one column.  Otherwise,
 // StructScan is used.  Get will return sql.ErrNoRows like row.Scan would.
@@ -783,13 +1087,17 @@ func (r *Row) scanAny(dest interface{}, structOnly bool) error {
 		return fmt.Errorf("missing destination name %s in %T", columns[f], dest)
 	}
 	values := make([]interface{}, len(columns))
+	nested := newNestedPtrs(v.Type(), fields)
 
-	err = fieldsByTraversal(v, fields, values, true)
+	err = fieldsByTraversal(v, nested.direct(fields), values, true)
 	if err != nil {
 		return err
 	}
+	nested.prepare(values)
 	// scan into the struct field pointers and append to our results
-	return r.Scan(values...)
+	return r.scan(values, func() error {
+		return nested.set(v, values, r.rows.Scan)
+	})
 }
 
 // StructScan a single Row into dest.
@@ -899,6 +1207,13 @@ func structOnlyError(t reflect.Type) error {
 func scanAll(rows rowsi, dest interface{}, structOnly bool) error {
 	var v, vp reflect.Value
 
+	switch d := dest.(type) {
+	case MapDest:
+		return scanMap(rows, d, structOnly)
+	case *MapDest:
+		return scanMap(rows, *d, structOnly)
+	}
+
 	value := reflect.ValueOf(dest)
 
 	// json.Unmarshal returns errors for these
@@ -910,6 +1225,10 @@ func scanAll(rows rowsi, dest interface{}, structOnly bool) error {
 	}
 	direct := reflect.Indirect(value)
 
+	if direct.Kind() == reflect.Map {
+		return scanMap(rows, MapDest{Dest: dest}, structOnly)
+	}
+
 	slice, err := baseType(value.Type(), reflect.Slice)
 	if err != nil {
 		return err
@@ -945,12 +1264,25 @@ func scanAll(rows rowsi, dest interface{}, structOnly bool) error {
 			m = mapper()
 		}
 
+		plan, missing, err := newJoinPlan(m, base, columns)
+		if err != nil {
+			return err
+		}
+		if plan != nil {
+			if len(missing) > 0 && !isUnsafe(rows) {
+				return fmt.Errorf("missing destination name %s in %T", columns[missing[0]], dest)
+			}
+			return scanJoin(rows, plan, len(columns), direct, isPtr)
+		}
+
 		fields := m.TraversalsByName(base, columns)
 		// if we are not unsafe and are missing fields, return an error
 		if f, err := missingFields(fields); err != nil && !isUnsafe(rows) {
 			return fmt.Errorf("missing destination name %s in %T", columns[f], dest)
 		}
 		values = make([]interface{}, len(columns))
+		nested := newNestedPtrs(base, fields)
+		fields = nested.direct(fields)
 
 		for rows.Next() {
 			// create a new struct type (which returns PtrTo) and indirect it
@@ -961,12 +1293,16 @@ func scanAll(rows rowsi, dest interface{}, structOnly bool) error {
 			if err != nil {
 				return err
 			}
+			nested.prepare(values)
 
 			// scan into the struct field pointers and append to our results
 			err = rows.Scan(values...)
 			if err != nil {
 				return err
 			}
+			if err = nested.set(v, values, rows.Scan); err != nil {
+				return err
+			}
 
 			if isPtr {
 				direct.Set(reflect.Append(direct, vp))
@@ -993,6 +1329,221 @@ func scanAll(rows rowsi, dest interface{}, structOnly bool) error {
 	return rows.Err()
 }
 
+// MapDest is a destination for Select and StructScan which scans rows into a
+// map rather than a slice.  Dest is a pointer to a map[K]V, which has a value
+// for each key, or to a map[K][]V, which groups the rows with the same key.  V
+// can be anything a slice passed to Select can hold.
+//
+// The key of each row is the value of the column Key.  If Key is empty, it's
+// the column of the field of V tagged with the `key` option, as in
+// `db:"id,key"`.  If V is scannable rather than a struct, the rows must have
+// two columns, the key column and the value.  If the key column is a field of
+// V, its type must be assignable to K, or be an integer type no wider than K
+// with the same signedness, so that distinct keys can't collide.
+//
+// A key which is repeated in a map[K]V is an error, unless LastWins is set,
+// in which case the last row with that key is kept.
+//
+// Passing a pointer to a map to Select directly is the same as passing it in a
+// MapDest with no Key.
+type MapDest struct {
+	Dest     interface{}
+	Key      string
+	LastWins bool
+}
+
+// groupsRows returns whether a map with elem values groups rows, which is
+// when elem is a slice, unless it's a value of its own like []byte.
+func groupsRows(elem reflect.Type) bool {
+	return elem.Kind() == reflect.Slice && elem.Elem().Kind() != reflect.Uint8 &&
+		!reflect.PtrTo(elem).Implements(_scannerInterface)
+}
+
+// scanMap scans all rows into the map of d.
+func scanMap(rows rowsi, d MapDest, structOnly bool) error {
+	value := reflect.ValueOf(d.Dest)
+	if value.Kind() != reflect.Ptr {
+		return errors.New("must pass a pointer, not a value, to StructScan destination")
+	}
+	if value.IsNil() {
+		return errors.New("nil pointer passed to StructScan destination")
+	}
+	mapType, err := baseType(value.Type(), reflect.Map)
+	if err != nil {
+		return err
+	}
+	keyType, elem := mapType.Key(), mapType.Elem()
+
+	grouped := groupsRows(elem)
+	valType := elem
+	if grouped {
+		valType = elem.Elem()
+	}
+	isPtr := valType.Kind() == reflect.Ptr
+	base := reflectx.Deref(valType)
+	scannable := isScannable(base)
+
+	if structOnly && scannable {
+		return structOnlyError(base)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	var fields [][]int
+	key := d.Key
+	if scannable {
+		if len(columns) != 2 {
+			return fmt.Errorf("non-struct map value type %s needs a key column and one value column, got %d columns", base.Kind(), len(columns))
+		}
+		if key == "" {
+			return fmt.Errorf("no key column for non-struct map value type %s", base.Kind())
+		}
+	} else {
+		var m *reflectx.Mapper
+		switch rows := rows.(type) {
+		case *Rows:
+			m = rows.Mapper
+		default:
+			m = mapper()
+		}
+		fields = m.TraversalsByName(base, columns)
+		if key == "" {
+			for _, fi := range m.TypeMap(base).Index {
+				if _, ok := fi.Options["key"]; ok {
+					key = fi.Path
+					break
+				}
+			}
+			if key == "" {
+				return fmt.Errorf("no key column for %s: name one with MapDest or tag a field with `db:\",key\"`", base)
+			}
+		}
+	}
+
+	keyIdx := -1
+	for i, column := range columns {
+		if column == key {
+			keyIdx = i
+			break
+		}
+	}
+	if keyIdx == -1 {
+		return fmt.Errorf("missing key column %s in result", key)
+	}
+
+	if !scannable {
+		// the key column doesn't have to be a field of the struct
+		for i, f := range fields {
+			if len(f) == 0 && i != keyIdx && !isUnsafe(rows) {
+				return fmt.Errorf("missing destination name %s in %T", columns[i], d.Dest)
+			}
+		}
+		if t := fields[keyIdx]; len(t) > 0 {
+			ft := base
+			for _, i := range t {
+				ft = reflectx.Deref(ft).Field(i).Type
+			}
+			if !keyConvertible(ft, keyType) {
+				return fmt.Errorf("key column %s of type %s can't be used as a %s map key", key, ft, keyType)
+			}
+		}
+	}
+
+	direct := value.Elem()
+	direct.Set(reflect.MakeMap(mapType))
+	values := make([]interface{}, len(columns))
+
+	// the key is always scanned into its field, if it has one
+	var nested *nestedPtrs
+	if !scannable {
+		others := append([][]int(nil), fields...)
+		others[keyIdx] = nil
+		nested = newNestedPtrs(base, others)
+	}
+	scanFields := nested.direct(fields)
+
+	for rows.Next() {
+		vp := reflect.New(base)
+		v := vp.Elem()
+
+		// the key is scanned into kp unless it's scanned into a field
+		var kp reflect.Value
+		if scannable {
+			kp = reflect.New(keyType)
+			values[keyIdx], values[1-keyIdx] = kp.Interface(), vp.Interface()
+		} else {
+			if err = fieldsByTraversal(v, scanFields, values, true); err != nil {
+				return err
+			}
+			nested.prepare(values)
+			if len(fields[keyIdx]) == 0 {
+				kp = reflect.New(keyType)
+				values[keyIdx] = kp.Interface()
+			}
+		}
+		if err = rows.Scan(values...); err != nil {
+			return err
+		}
+
+		var k reflect.Value
+		if kp.IsValid() {
+			k = kp.Elem()
+		} else {
+			k = reflectx.FieldByIndexesReadOnly(v, fields[keyIdx]).Convert(keyType)
+		}
+		if err = nested.set(v, values, rows.Scan); err != nil {
+			return err
+		}
+		val := v
+		if isPtr {
+			val = vp
+		}
+
+		if grouped {
+			group := direct.MapIndex(k)
+			if !group.IsValid() {
+				group = reflect.Zero(elem)
+			}
+			direct.SetMapIndex(k, reflect.Append(group, val))
+			continue
+		}
+		if !d.LastWins && direct.MapIndex(k).IsValid() {
+			return fmt.Errorf("duplicate key %v in column %s", k.Interface(), key)
+		}
+		direct.SetMapIndex(k, val)
+	}
+
+	return rows.Err()
+}
+
+// keyConvertible returns whether a key column scanned into a field of type
+// from can be converted to a map key of type to without changing its value, so
+// an integer can only be converted to one of the same signedness which is at
+// least as wide.
+func keyConvertible(from, to reflect.Type) bool {
+	if from.AssignableTo(to) {
+		return true
+	}
+	switch from.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch to.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return to.Bits() >= from.Bits()
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch to.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return to.Bits() >= from.Bits()
+		}
+	case reflect.String:
+		return to.Kind() == reflect.String
+	}
+	return false
+}
+
 // FIXME: StructScan was the very first bit of API in sqlx, and now unfortunately
 // it doesn't really feel like it's named properly.  There is an incongruency
 // between this and the way that StructScan (which might better be ScanStruct
@@ -1052,3 +1603,138 @@ func missingFields(transversals [][]int) (field int, err error) {
 	}
 	return 0, nil
 }
+
+// nestedPtrs are the columns of a scan which are mapped under pointers to
+// structs, like "manager.name" for a field Manager *Person.  They are scanned
+// into temporaries rather than into the fields, so that a pointer is only
+// allocated if one of the columns under it isn't NULL, and is left nil as for
+// the rows of an outer join otherwise.  The NULL columns under an allocated
+// pointer are scanned again into their fields, so that a field which can't be
+// NULL is an error as it would be without the pointer.
+type nestedPtrs struct {
+	cols   []int           // the columns under pointers
+	fields [][]int         // the traversal of each of cols
+	held   []reflect.Value // the temporary of each of cols, a **T
+	ptrs   [][]int         // the traversals of the pointers
+	under  [][]int         // the positions in cols under each pointer
+}
+
+// newNestedPtrs returns the nestedPtrs of the struct type t for traversals,
+// or nil if none of them go through a pointer.
+func newNestedPtrs(t reflect.Type, traversals [][]int) *nestedPtrs {
+	t = reflectx.Deref(t)
+	n := &nestedPtrs{}
+	seen := map[string]int{}
+	for i, traversal := range traversals {
+		ft := t
+		var ptrs []int
+		var f reflect.StructField
+		for k, index := range traversal {
+			f = ft.Field(index)
+			if k < len(traversal)-1 && f.Type.Kind() == reflect.Ptr {
+				ptrs = append(ptrs, k+1)
+			}
+			ft = reflectx.Deref(f.Type)
+		}
+		if len(ptrs) == 0 {
+			continue
+		}
+
+		j := len(n.cols)
+		n.cols = append(n.cols, i)
+		n.fields = append(n.fields, traversal)
+		n.held = append(n.held, reflect.New(reflect.PtrTo(f.Type)))
+		for _, k := range ptrs {
+			key := fmt.Sprint(traversal[:k])
+			p, ok := seen[key]
+			if !ok {
+				p = len(n.ptrs)
+				seen[key] = p
+				n.ptrs = append(n.ptrs, traversal[:k])
+				n.under = append(n.under, nil)
+			}
+			n.under[p] = append(n.under[p], j)
+		}
+	}
+	if len(n.cols) == 0 {
+		return nil
+	}
+	return n
+}
+
+// direct returns traversals without the columns of n, so fieldsByTraversal
+// doesn't allocate their pointers.
+func (n *nestedPtrs) direct(traversals [][]int) [][]int {
+	if n == nil {
+		return traversals
+	}
+	direct := append([][]int(nil), traversals...)
+	for _, c := range n.cols {
+		direct[c] = nil
+	}
+	return direct
+}
+
+// prepare sets the values of the columns of n to their temporaries.  It must
+// be called after fieldsByTraversal.
+func (n *nestedPtrs) prepare(values []interface{}) {
+	if n == nil {
+		return
+	}
+	for j, c := range n.cols {
+		values[c] = n.held[j].Interface()
+	}
+}
+
+// set sets the fields of v from the scanned temporaries, allocating the
+// pointers over a column which isn't NULL and setting the others to nil.
+// values are those the row was scanned into, and rescan scans the row again
+// for the NULL columns under allocated pointers.
+func (n *nestedPtrs) set(v reflect.Value, values []interface{}, rescan func(dest ...interface{}) error) error {
+	if n == nil {
+		return nil
+	}
+	v = reflect.Indirect(v)
+	for p, ptr := range n.ptrs {
+		null := true
+		for _, j := range n.under[p] {
+			if !n.held[j].Elem().IsNil() {
+				null = false
+				break
+			}
+		}
+		if f, ok := allocatedField(v, ptr); null && ok && f.CanSet() {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+	var nulls bool
+	for j, traversal := range n.fields {
+		if h := n.held[j].Elem(); !h.IsNil() {
+			reflectx.FieldByIndexes(v, traversal).Set(h.Elem())
+		} else if f, ok := allocatedField(v, traversal); ok {
+			values[n.cols[j]] = f.Addr().Interface()
+			nulls = true
+		}
+	}
+	if !nulls {
+		return nil
+	}
+	err := rescan(values...)
+	n.prepare(values)
+	return err
+}
+
+// allocatedField is reflectx.FieldByIndexes without allocating nil pointers.
+// It returns false if there is one on the way to the field.
+func allocatedField(v reflect.Value, indexes []int) (reflect.Value, bool) {
+	for _, i := range indexes {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
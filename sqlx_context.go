@@ -6,10 +6,13 @@ package sqlx
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
+
+	"github.com/jmoiron/sqlx/reflectx"
 )
 
 // ConnectContext to a database and verify with a ping.
@@ -62,6 +65,61 @@ func SelectContext(ctx context.Context, q QueryerContext, dest interface{}, quer
 	return scanAll(rows, dest, false)
 }
 
+// SelectEach executes a query using the provided QueryerContext and scans each
+// row into dest, which must be a pointer to a struct or a scannable type, then
+// calls fn.  Unlike SelectContext, the rows are not buffered, so it can be used
+// for result sets too large to hold in memory.  The same dest is reused for
+// every row, so fn must copy anything which should outlive the call.  If fn
+// returns an error, SelectEach stops and returns it.  The rows are always
+// closed, and any error from iterating them is returned.
+func SelectEach(ctx context.Context, q QueryerContext, dest interface{}, query string, args []interface{}, fn func() error) error {
+	rows, err := q.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return scanEach(rows, dest, fn)
+}
+
+// scanEach scans each of rows into dest and calls fn after each one.
+func scanEach(rows *Rows, dest interface{}, fn func() error) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr {
+		return errors.New("must pass a pointer, not a value, to SelectEach destination")
+	}
+	if v.IsNil() {
+		return errors.New("nil pointer passed to SelectEach destination")
+	}
+	scannable := isScannable(reflectx.Deref(v.Type()))
+
+	for rows.Next() {
+		var err error
+		if scannable {
+			err = rows.Scan(dest)
+		} else {
+			// StructScan keeps the traversals of the columns after the
+			// first row, so each later row is scanned without mapping
+			err = rows.StructScan(dest)
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SelectInContext is like SelectContext, but first expands slice values in
+// args as In does and rebinds the query from `?` to the bindvar type of q.
+// See SelectIn for how empty slices and bindvar limits are handled.
+func SelectInContext(ctx context.Context, q ExtContext, dest interface{}, query string, args ...interface{}) error {
+	return selectIn(q.DriverName(), inOptionsFor(q), dest, query, args, func(dest interface{}, query string, args []interface{}) error {
+		return SelectContext(ctx, q, dest, query, args...)
+	})
+}
+
 // PreparexContext prepares a statement.
 //
 // The provided context is used for the preparation of the statement, not for
@@ -141,6 +199,18 @@ func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string,
 	return SelectContext(ctx, db, dest, query, args...)
 }
 
+// SelectEach using this DB.
+// Any placeholder parameters are replaced with supplied args.
+func (db *DB) SelectEach(ctx context.Context, dest interface{}, query string, args []interface{}, fn func() error) error {
+	return SelectEach(ctx, db, dest, query, args, fn)
+}
+
+// SelectInContext using this DB.
+// Slice values in args are expanded as with In.
+func (db *DB) SelectInContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return SelectInContext(ctx, db, dest, query, args...)
+}
+
 // GetContext using this DB.
 // Any placeholder parameters are replaced with supplied args.
 // An error is returned if the result set is empty.
@@ -206,7 +276,7 @@ func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{Tx: tx, driverName: db.driverName, unsafe: db.unsafe, Mapper: db.Mapper}, err
+	return &Tx{Tx: tx, driverName: db.driverName, unsafe: db.unsafe, Mapper: db.Mapper, inOpts: db.inOpts, cache: db.cache}, err
 }
 
 // Connx returns an *sqlx.Conn instead of an *sql.Conn.
@@ -216,7 +286,7 @@ func (db *DB) Connx(ctx context.Context) (*Conn, error) {
 		return nil, err
 	}
 
-	return &Conn{Conn: conn, driverName: db.driverName, unsafe: db.unsafe, Mapper: db.Mapper}, nil
+	return &Conn{Conn: conn, driverName: db.driverName, unsafe: db.unsafe, Mapper: db.Mapper, inOpts: db.inOpts, cache: db.cache}, nil
 }
 
 // BeginTxx begins a transaction and returns an *sqlx.Tx instead of an
@@ -231,7 +301,7 @@ func (c *Conn) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{Tx: tx, driverName: c.driverName, unsafe: c.unsafe, Mapper: c.Mapper}, err
+	return &Tx{Tx: tx, driverName: c.driverName, unsafe: c.unsafe, Mapper: c.Mapper, inOpts: c.inOpts, cache: c.cache}, err
 }
 
 // SelectContext using this Conn.
@@ -274,7 +344,19 @@ func (c *Conn) QueryRowxContext(ctx context.Context, query string, args ...inter
 
 // Rebind a query within a Conn's bindvar type.
 func (c *Conn) Rebind(query string) string {
-	return Rebind(BindType(c.driverName), query)
+	return c.cache.rebind(BindType(c.driverName), query)
+}
+
+// RebindFrom transforms a query from bindType to the Conn's bindvar type,
+// reordering and repeating args as needed.  See sqlx.RebindFrom.
+func (c *Conn) RebindFrom(bindType int, query string, args ...interface{}) (string, []interface{}, error) {
+	return RebindFrom(bindType, BindType(c.driverName), query, args...)
+}
+
+// In expands slice values in args like In, returning a query which uses the
+// Conn's bindvar type.
+func (c *Conn) In(query string, args ...interface{}) (string, []interface{}, error) {
+	return bindIn(c.driverName, c.inOpts, query, args)
 }
 
 // StmtxContext returns a version of the prepared statement which runs within a
@@ -301,6 +383,8 @@ func (tx *Tx) NamedStmtContext(ctx context.Context, stmt *NamedStmt) *NamedStmt
 		QueryString: stmt.QueryString,
 		Params:      stmt.Params,
 		Stmt:        tx.StmtxContext(ctx, stmt.Stmt),
+		native:      stmt.native,
+		defaults:    stmt.defaults,
 	}
 }
 
@@ -339,6 +423,18 @@ func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string,
 	return SelectContext(ctx, tx, dest, query, args...)
 }
 
+// SelectEach within a transaction and context.
+// Any placeholder parameters are replaced with supplied args.
+func (tx *Tx) SelectEach(ctx context.Context, dest interface{}, query string, args []interface{}, fn func() error) error {
+	return SelectEach(ctx, tx, dest, query, args, fn)
+}
+
+// SelectInContext within a transaction and context.
+// Slice values in args are expanded as with In.
+func (tx *Tx) SelectInContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return SelectInContext(ctx, tx, dest, query, args...)
+}
+
 // GetContext within a transaction and context.
 // Any placeholder parameters are replaced with supplied args.
 // An error is returned if the result set is empty.
@@ -365,6 +461,12 @@ func (s *Stmt) SelectContext(ctx context.Context, dest interface{}, args ...inte
 	return SelectContext(ctx, &qStmt{s}, dest, "", args...)
 }
 
+// SelectEach using the prepared statement.
+// Any placeholder parameters are replaced with supplied args.
+func (s *Stmt) SelectEach(ctx context.Context, dest interface{}, args []interface{}, fn func() error) error {
+	return SelectEach(ctx, &qStmt{s}, dest, "", args, fn)
+}
+
 // GetContext using the prepared statement.
 // Any placeholder parameters are replaced with supplied args.
 // An error is returned if the result set is empty.
@@ -16,6 +16,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -1425,3 +1426,68 @@ func TestConn(t *testing.T) {
 		}
 	})
 }
+
+func TestSelectEach(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		ctx := context.Background()
+
+		var p Place
+		var codes []int
+		err := db.SelectEach(ctx, &p, "SELECT * FROM place ORDER BY telcode ASC", nil, func() error {
+			codes = append(codes, p.TelCode)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(codes) != 3 || codes[0] != 1 || codes[2] != 852 {
+			t.Errorf("unexpected telcodes %v", codes)
+		}
+
+		// an error from the callback stops the scan
+		stop := errors.New("stop")
+		var n int
+		err = db.SelectEach(ctx, &p, "SELECT * FROM place", nil, func() error {
+			n++
+			return stop
+		})
+		if err != stop || n != 1 {
+			t.Errorf("expected to stop after 1 row, got %d rows and %v", n, err)
+		}
+
+		var code int
+		var sum int
+		tx := db.MustBegin()
+		err = tx.SelectEach(ctx, &code, tx.Rebind("SELECT telcode FROM place WHERE telcode > ?"), []interface{}{10}, func() error {
+			sum += code
+			return nil
+		})
+		tx.Rollback()
+		if err != nil || sum != 852+65 {
+			t.Errorf("expected a sum of %d, got %d %v", 852+65, sum, err)
+		}
+
+		stmt, err := db.Preparex(db.Rebind("SELECT * FROM person WHERE first_name = ?"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		var person Person
+		var names []string
+		err = stmt.SelectEach(ctx, &person, []interface{}{"John"}, func() error {
+			names = append(names, person.LastName)
+			return nil
+		})
+		if err != nil || len(names) != 1 || names[0] != "Doe" {
+			t.Errorf("unexpected names %v %v", names, err)
+		}
+
+		if err := db.SelectEach(ctx, p, "SELECT * FROM place", nil, func() error { return nil }); err == nil {
+			t.Error("expected an error for a non-pointer destination")
+		}
+		if err := db.SelectEach(ctx, &p, "SELECT *, 1 AS extra FROM place", nil, func() error { return nil }); err == nil {
+			t.Error("expected an error for a missing destination field")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package sqlx
+
+import (
+	"context"
+	"iter"
+	"reflect"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// SelectT executes a query using the provided QueryerContext, and returns a
+// slice of T with a value for each row.  It is SelectContext with the type of
+// the destination known at compile time.  The Mapper and unsafe settings of
+// the DB, Tx or Conn passed as q are used as they are by SelectContext.
+func SelectT[T any](ctx context.Context, q QueryerContext, query string, args ...interface{}) ([]T, error) {
+	var dest []T
+	if err := SelectContext(ctx, q, &dest, query, args...); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// GetT executes a query using the provided QueryerContext, and returns its
+// single row as a T.  As with GetContext, sql.ErrNoRows is returned if there
+// are no rows.
+func GetT[T any](ctx context.Context, q QueryerContext, query string, args ...interface{}) (T, error) {
+	var dest T
+	if err := GetContext(ctx, q, &dest, query, args...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return dest, nil
+}
+
+// Iter returns an iterator over rows which scans each row into a T, which can
+// be a struct, a scannable type or a pointer to either, as with Select.  The
+// rows are closed when the iteration ends.  If a row can't be scanned, or rows
+// has an error, it is yielded with the zero T and the iteration ends.
+//
+//	rows, err := db.QueryxContext(ctx, "SELECT * FROM person")
+//	...
+//	for p, err := range sqlx.Iter[Person](rows) {
+//		...
+//	}
+func Iter[T any](rows *Rows) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer rows.Close()
+
+		t := reflect.TypeOf((*T)(nil)).Elem()
+		isPtr := t.Kind() == reflect.Ptr
+		base := reflectx.Deref(t)
+		scannable := isScannable(base)
+
+		var zero T
+		for rows.Next() {
+			vp := reflect.New(base)
+			var err error
+			if scannable {
+				err = rows.Scan(vp.Interface())
+			} else {
+				err = rows.StructScan(vp.Interface())
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if isPtr {
+				if !yield(vp.Interface().(T), nil) {
+					return
+				}
+			} else if !yield(vp.Elem().Interface().(T), nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestGenerics(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		ctx := context.Background()
+
+		people, err := SelectT[Person](ctx, db, "SELECT * FROM person ORDER BY first_name ASC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(people) != 2 || people[0].FirstName != "Jason" || people[1].FirstName != "John" {
+			t.Errorf("unexpected people %#v", people)
+		}
+
+		ptrs, err := SelectT[*Place](ctx, db, "SELECT * FROM place ORDER BY telcode ASC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ptrs) != 3 || ptrs[0].TelCode != 1 || !ptrs[0].City.Valid || ptrs[2].TelCode != 852 {
+			t.Errorf("unexpected places %#v", ptrs)
+		}
+
+		codes, err := SelectT[int](ctx, db, "SELECT telcode FROM place ORDER BY telcode ASC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(codes) != 3 || codes[1] != 65 {
+			t.Errorf("unexpected codes %v", codes)
+		}
+
+		// the settings of the DB or Tx are used
+		if _, err := SelectT[Place](ctx, db, "SELECT *, 1 AS extra FROM place"); err == nil {
+			t.Error("expected an error for a missing destination field")
+		}
+		tx := db.Unsafe().MustBegin()
+		if _, err := SelectT[Place](ctx, tx, "SELECT *, 1 AS extra FROM place"); err != nil {
+			t.Errorf("expected no error on an unsafe Tx, got %v", err)
+		}
+		tx.Rollback()
+
+		p, err := GetT[Person](ctx, db, db.Rebind("SELECT * FROM person WHERE first_name = ?"), "John")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.LastName != "Doe" {
+			t.Errorf("unexpected person %#v", p)
+		}
+		if _, err := GetT[Person](ctx, db, db.Rebind("SELECT * FROM person WHERE first_name = ?"), "Nobody"); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows, got %v", err)
+		}
+		n, err := GetT[int](ctx, db, "SELECT count(*) FROM place")
+		if err != nil || n != 3 {
+			t.Errorf("expected 3, got %d %v", n, err)
+		}
+
+		rows, err := db.QueryxContext(ctx, "SELECT * FROM place ORDER BY telcode ASC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for p, err := range Iter[Place](rows) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, p.TelCode)
+		}
+		if len(got) != 3 || got[0] != 1 || got[2] != 852 {
+			t.Errorf("unexpected telcodes %v", got)
+		}
+
+		// breaking out of the loop closes the rows
+		rows, err = db.QueryxContext(ctx, "SELECT * FROM place ORDER BY telcode ASC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p, err := range Iter[*Place](rows) {
+			if err != nil || p.TelCode != 1 {
+				t.Errorf("unexpected place %#v %v", p, err)
+			}
+			break
+		}
+		if rows.Next() {
+			t.Error("expected the rows to be closed")
+		}
+
+		rows, err = db.QueryxContext(ctx, "SELECT *, 1 AS extra FROM place")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var errs int
+		for _, err := range Iter[Place](rows) {
+			if err != nil {
+				errs++
+			}
+		}
+		if errs != 1 {
+			t.Errorf("expected the iteration to end at the first error, got %d errors", errs)
+		}
+	})
+}
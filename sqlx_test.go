@@ -1604,6 +1604,171 @@ func TestIn(t *testing.T) {
 	})
 }
 
+func TestSelectIn(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		q := "SELECT * FROM place WHERE telcode IN (?) ORDER BY telcode"
+
+		places := []Place{}
+		if err := db.SelectIn(&places, q, []int{852, 65}); err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 2 || places[0].TelCode != 65 {
+			t.Errorf("expected singapore and hong kong, got %#v", places)
+		}
+
+		type key struct {
+			Country string
+			TelCode int
+		}
+		q2 := "SELECT * FROM place WHERE (country, telcode) IN (?) ORDER BY telcode"
+		if err := db.SelectIn(&places, q2, []key{{"Hong Kong", 852}, {"Singapore", 1}}); err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 1 || places[0].TelCode != 852 {
+			t.Errorf("expected hong kong, got %#v", places)
+		}
+
+		if err := db.SelectIn(&places, q, []int{}); err != ErrEmptySlice {
+			t.Errorf("expected ErrEmptySlice, got %v", err)
+		}
+
+		// short circuited, so the query isn't even run
+		err := db.EmptySlices(EmptySliceNoRows).SelectIn(&places, "SELECT * FROM nothing WHERE x IN (?)", []int{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 0 {
+			t.Errorf("expected no places, got %d", len(places))
+		}
+		byCode := map[int]Place{1: {}}
+		err = db.EmptySlices(EmptySliceNoRows).SelectIn(&MapDest{Dest: &byCode, Key: "telcode"}, "SELECT * FROM nothing WHERE x IN (?)", []int{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if byCode == nil || len(byCode) != 0 {
+			t.Errorf("expected an empty map, got %v", byCode)
+		}
+		if err := db.EmptySlices(EmptySliceNoRows).SelectIn(&Place{}, "SELECT * FROM nothing WHERE x IN (?)", []int{}); err == nil {
+			t.Error("expected an error for a struct destination")
+		}
+
+		tx := db.EmptySlices(EmptySliceFalse).MustBegin()
+		defer tx.Rollback()
+		q = "SELECT * FROM place WHERE telcode NOT IN (?) AND telcode IN (?)"
+		if err := tx.SelectIn(&places, q, []int{}, []int{1, 65}); err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 2 {
+			t.Errorf("expected 2 places, got %d", len(places))
+		}
+		if err := tx.SelectIn(&places, "SELECT * FROM place WHERE telcode IN (?)", []int{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 0 {
+			t.Errorf("expected no places, got %d", len(places))
+		}
+	})
+}
+
+func TestBindLimit(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		limit := BindLimit(db.DriverName())
+		defer BindLimitDriver(db.DriverName(), limit)
+		BindLimitDriver(db.DriverName(), 7)
+
+		places := []Place{
+			{Country: "Canada", TelCode: 1},
+			{Country: "Japan", TelCode: 81},
+			{Country: "France", TelCode: 33},
+			{Country: "Germany", TelCode: 49},
+			{Country: "Sweden", TelCode: 46},
+		}
+		// 3 bindvars for each place, so 2 places are inserted at a time
+		res, err := db.NamedExec("INSERT INTO place (country, city, telcode) VALUES (:country, :city, :telcode)", places)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 5 {
+			t.Errorf("expected 5 rows affected, got %d (%v)", n, err)
+		}
+
+		// the other bindvar leaves room for 3 telcodes in each query
+		BindLimitDriver(db.DriverName(), 4)
+		codes := []int{1, 81, 33, 49, 46, 99, 98, 97}
+		var got []Place
+		// SelectIn splits queries by default
+		err = db.SelectIn(&got, "SELECT * FROM place WHERE telcode > ? AND telcode IN (?)", 1, codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 4 {
+			t.Fatalf("expected 4 places, got %d", len(got))
+		}
+
+		// unless it is turned off, when the query goes to the driver as it is
+		var unsplit []Place
+		err = db.SplitIn(false).SelectIn(&unsplit, "SELECT * FROM place WHERE telcode > ? AND telcode IN (?)", 1, codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(unsplit) != 4 {
+			t.Fatalf("expected 4 places, got %d", len(unsplit))
+		}
+
+		// queries whose rows would be different if they were split are not
+		var n []int
+		err = db.SelectIn(&n, "SELECT count(*) FROM place WHERE telcode > ? AND telcode IN (?)", 1, codes)
+		if err == nil || !strings.Contains(err.Error(), "limit of 4") {
+			t.Errorf("expected a bind limit error, got %v (%v)", err, n)
+		}
+		err = db.SelectIn(&got, "SELECT * FROM place WHERE telcode > ? AND telcode IN (?) ORDER BY telcode LIMIT 1", 1, codes)
+		if err == nil || !strings.Contains(err.Error(), "limit of 4") {
+			t.Errorf("expected a bind limit error, got %v", err)
+		}
+
+		// maps are merged across chunks
+		byCode := map[int]Place{0: {}}
+		err = db.SelectIn(&MapDest{Dest: &byCode, Key: "telcode"}, "SELECT * FROM place WHERE telcode > ? AND telcode IN (?)", 1, codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(byCode) != 4 || byCode[81].Country != "Japan" {
+			t.Errorf("expected 4 places, got %v", byCode)
+		}
+		var bySize map[bool][]string
+		err = db.SelectIn(MapDest{Dest: &bySize, Key: "big"}, "SELECT telcode > 40 AS big, country FROM place WHERE telcode > ? AND telcode IN (?)", 1, codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bySize[true]) != 3 || len(bySize[false]) != 1 {
+			t.Errorf("expected 3 big and 1 small, got %v", bySize)
+		}
+		var byBig map[bool]string
+		err = db.SelectIn(&MapDest{Dest: &byBig, Key: "big"}, "SELECT telcode > 40 AS big, country FROM place WHERE telcode > ? AND telcode IN (?) AND telcode <> 46", 1, codes)
+		if err == nil || !strings.Contains(err.Error(), "duplicate key true") {
+			t.Errorf("expected a duplicate key error, got %v", err)
+		}
+	})
+}
+
+func TestRebindFrom(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		q, args, err := db.RebindFrom(DOLLAR, "SELECT * FROM place WHERE telcode = $2 OR (telcode > $1 AND telcode < $2) ORDER BY telcode", 1, 65)
+		if err != nil {
+			t.Fatal(err)
+		}
+		places := []Place{}
+		if err := db.Select(&places, q, args...); err != nil {
+			t.Fatal(err)
+		}
+		if len(places) != 1 || places[0].TelCode != 65 {
+			t.Errorf("expected singapore, got %#v", places)
+		}
+	})
+}
+
 func TestBindStruct(t *testing.T) {
 	var err error
 
@@ -1840,15 +2005,17 @@ func BenchmarkRebind(b *testing.B) {
 	}
 }
 
-func BenchmarkRebindBuffer(b *testing.B) {
-	b.StopTimer()
-	q1 := `INSERT INTO foo (a, b, c, d, e, f, g, h, i) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	q2 := `INSERT INTO foo (a, b, c) VALUES (?, ?, "foo"), ("Hi", ?, ?)`
-	b.StartTimer()
+func BenchmarkRebindPlain(b *testing.B) {
+	q := `INSERT INTO foo (a, b, c, d, e, f, g, h, i) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for i := 0; i < b.N; i++ {
+		Rebind(DOLLAR, q)
+	}
+}
 
+func BenchmarkRebindLiterals(b *testing.B) {
+	q := `INSERT INTO foo (a, b, c) VALUES (?, ?, "foo"), ("Hi", ?, ?) -- ?`
 	for i := 0; i < b.N; i++ {
-		rebindBuff(DOLLAR, q1)
-		rebindBuff(DOLLAR, q2)
+		Rebind(DOLLAR, q)
 	}
 }
 
@@ -1923,3 +2090,314 @@ func TestSelectReset(t *testing.T) {
 		}
 	})
 }
+
+func TestSelectMap(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T, now string) {
+		loadDefaultFixture(db, t)
+		db.MustExec(db.Rebind("INSERT INTO place (country, city, telcode) VALUES (?, ?, ?)"), "United States", "Boston", 617)
+
+		type keyedPlace struct {
+			Country string
+			City    sql.NullString
+			TelCode int64 `db:"telcode,key"`
+		}
+		byCode := map[int]keyedPlace{}
+		if err := db.Select(&byCode, "SELECT * FROM place"); err != nil {
+			t.Fatal(err)
+		}
+		if len(byCode) != 4 || byCode[852].Country != "Hong Kong" || byCode[617].City.String != "Boston" {
+			t.Errorf("unexpected places %#v", byCode)
+		}
+
+		// rows with the same key are grouped in a map of slices
+		var byCountry map[string][]*Place
+		err := db.Select(&MapDest{Dest: &byCountry, Key: "country"}, "SELECT * FROM place ORDER BY telcode")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if us := byCountry["United States"]; len(byCountry) != 3 || len(us) != 2 || us[0].TelCode != 1 || us[1].TelCode != 617 {
+			t.Errorf("unexpected places %#v", byCountry)
+		}
+
+		// repeated keys are an error unless the last one wins
+		var single map[string]Place
+		err = db.Select(&MapDest{Dest: &single, Key: "country"}, "SELECT * FROM place ORDER BY telcode")
+		if err == nil || !strings.Contains(err.Error(), "duplicate key United States") {
+			t.Errorf("expected a duplicate key error, got %v", err)
+		}
+		err = db.Select(MapDest{Dest: &single, Key: "country", LastWins: true}, "SELECT * FROM place ORDER BY telcode")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(single) != 3 || single["United States"].TelCode != 617 {
+			t.Errorf("unexpected places %#v", single)
+		}
+
+		// the key column doesn't have to be in the struct
+		type city struct {
+			City sql.NullString
+		}
+		var cities map[int64][]city
+		err = db.Select(&MapDest{Dest: &cities, Key: "telcode"}, "SELECT city, telcode FROM place")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cities) != 4 || cities[1][0].City.String != "New York" {
+			t.Errorf("unexpected cities %#v", cities)
+		}
+
+		// scannable values need a key and a value column
+		var codes map[string][]int
+		err = db.Select(&MapDest{Dest: &codes, Key: "country"}, "SELECT country, telcode FROM place ORDER BY telcode")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(codes["United States"]) != 2 || codes["Singapore"][0] != 65 {
+			t.Errorf("unexpected codes %#v", codes)
+		}
+
+		// keys can be converted to a wider type of the same signedness
+		var wide map[int64]Place
+		err = db.Select(&MapDest{Dest: &wide, Key: "telcode"}, "SELECT * FROM place")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wide[65].Country != "Singapore" {
+			t.Errorf("unexpected places %#v", wide)
+		}
+
+		errs := []struct {
+			dest  interface{}
+			query string
+		}{
+			{&map[int]Place{}, "SELECT * FROM place"},
+			{&MapDest{Dest: &map[int]Place{}, Key: "nope"}, "SELECT * FROM place"},
+			{&MapDest{Dest: &map[string]int{}, Key: "country"}, "SELECT * FROM place"},
+			{&map[string]keyedPlace{}, "SELECT * FROM place"},
+			{&MapDest{Dest: &map[int]city{}, Key: "telcode"}, "SELECT * FROM place"},
+			// keys which would be truncated or change sign
+			{&MapDest{Dest: &map[int8]Place{}, Key: "telcode"}, "SELECT * FROM place"},
+			{&MapDest{Dest: &map[uint64]Place{}, Key: "telcode"}, "SELECT * FROM place"},
+		}
+		for _, e := range errs {
+			if err := db.Select(e.dest, e.query); err == nil {
+				t.Errorf("expected an error selecting into %T", e.dest)
+			}
+		}
+	})
+}
+
+func TestSelectJoin(t *testing.T) {
+	var schema = Schema{
+		create: `
+			CREATE TABLE author (
+				id integer,
+				name text
+			);
+			CREATE TABLE book (
+				id integer,
+				author_id integer,
+				title text
+			);
+			CREATE TABLE review (
+				id integer,
+				book_id integer,
+				stars integer
+			);`,
+		drop: `
+			drop table author;
+			drop table book;
+			drop table review;`,
+	}
+
+	RunWithSchema(schema, t, func(db *DB, t *testing.T, now string) {
+		MultiExec(db, `
+			INSERT INTO author (id, name) VALUES (1, 'Le Guin'), (2, 'Borges'), (3, 'Nobody');
+			INSERT INTO book (id, author_id, title) VALUES (10, 1, 'Earthsea'), (11, 1, 'Lathe'), (20, 2, 'Ficciones');
+			INSERT INTO review (id, book_id, stars) VALUES (100, 10, 5), (101, 10, 4), (200, 20, 5);`)
+
+		type review struct {
+			ID    int `db:"id,pk"`
+			Stars int
+		}
+		type book struct {
+			ID      int `db:"id,pk"`
+			Title   string
+			Reviews []review `db:"reviews"`
+		}
+		type author struct {
+			ID    int `db:"id,pk"`
+			Name  string
+			Books []*book `db:"books"`
+		}
+
+		var authors []author
+		err := db.Select(&authors, `
+			SELECT a.id, a.name, b.id AS "books.id", b.title AS "books.title",
+				r.id AS "books.reviews.id", r.stars AS "books.reviews.stars"
+			FROM author a
+			LEFT JOIN book b ON b.author_id = a.id
+			LEFT JOIN review r ON r.book_id = b.id
+			ORDER BY a.id, b.id, r.id`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(authors) != 3 {
+			t.Fatalf("expected 3 authors, got %#v", authors)
+		}
+		leGuin := authors[0]
+		if leGuin.Name != "Le Guin" || len(leGuin.Books) != 2 || leGuin.Books[0].Title != "Earthsea" {
+			t.Errorf("unexpected author %#v", leGuin)
+		}
+		if rs := leGuin.Books[0].Reviews; len(rs) != 2 || rs[0].ID != 100 || rs[1].Stars != 4 {
+			t.Errorf("unexpected reviews %#v", rs)
+		}
+		if leGuin.Books[1].Reviews != nil {
+			t.Errorf("expected no reviews, got %#v", leGuin.Books[1].Reviews)
+		}
+		if len(authors[1].Books) != 1 || len(authors[1].Books[0].Reviews) != 1 {
+			t.Errorf("unexpected author %#v", authors[1])
+		}
+		if authors[2].Name != "Nobody" || authors[2].Books != nil {
+			t.Errorf("unexpected author %#v", authors[2])
+		}
+
+		// without a pk, the rows of a parent can't be grouped
+		type unkeyed struct {
+			ID    int
+			Books []book `db:"books"`
+		}
+		var us []unkeyed
+		err = db.Select(&us, `SELECT a.id, b.id AS "books.id" FROM author a JOIN book b ON b.author_id = a.id`)
+		if err == nil || !strings.Contains(err.Error(), "no pk field") {
+			t.Errorf("expected a pk error, got %v", err)
+		}
+		// the pk columns must be selected
+		err = db.Select(&authors, `SELECT a.name, b.id AS "books.id" FROM author a JOIN book b ON b.author_id = a.id`)
+		if err == nil || !strings.Contains(err.Error(), "missing pk column id") {
+			t.Errorf("expected a missing pk error, got %v", err)
+		}
+		// a pk isn't needed without a join, or for a struct without slices
+		var plain []author
+		if err := db.Select(&plain, `SELECT name FROM author ORDER BY id`); err != nil {
+			t.Fatal(err)
+		}
+		if len(plain) != 3 || plain[1].Name != "Borges" {
+			t.Errorf("unexpected authors %#v", plain)
+		}
+		var plainBooks []book
+		if err := db.Select(&plainBooks, `SELECT title FROM book`); err != nil {
+			t.Fatal(err)
+		}
+		if len(plainBooks) != 3 {
+			t.Errorf("unexpected books %#v", plainBooks)
+		}
+		err = db.Select(&authors, `SELECT a.id, b.title AS "books.title" FROM author a JOIN book b ON b.author_id = a.id ORDER BY a.id`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(authors) != 2 || len(authors[0].Books) != 2 {
+			t.Errorf("unexpected authors %#v", authors)
+		}
+
+		err = db.Select(&authors, `SELECT a.id, b.id AS "books.id", b.author_id AS "books.author_id" FROM author a JOIN book b ON b.author_id = a.id`)
+		if err == nil || !strings.Contains(err.Error(), "missing destination name books.author_id") {
+			t.Errorf("expected a missing destination error, got %v", err)
+		}
+	})
+}
+
+func TestNilNestedPointers(t *testing.T) {
+	var schema = Schema{
+		create: `
+			CREATE TABLE employee (
+				id integer,
+				name text,
+				manager_id integer
+			);`,
+		drop: `drop table employee;`,
+	}
+
+	RunWithSchema(schema, t, func(db *DB, t *testing.T, now string) {
+		MultiExec(db, `
+			INSERT INTO employee (id, name, manager_id) VALUES (1, 'Boss', NULL), (2, 'Worker', 1);`)
+
+		type person struct {
+			ID   int
+			Name string
+		}
+		type Contact struct {
+			Phone sql.NullString
+		}
+		type employee struct {
+			person
+			Manager *person `db:"manager"`
+			*Contact
+		}
+		query := `
+			SELECT e.id, e.name, m.id AS "manager.id", m.name AS "manager.name", NULL AS phone
+			FROM employee e LEFT JOIN employee m ON m.id = e.manager_id
+			ORDER BY e.id`
+
+		var employees []employee
+		if err := db.Select(&employees, query); err != nil {
+			t.Fatal(err)
+		}
+		if len(employees) != 2 || employees[0].Manager != nil || employees[0].Contact != nil {
+			t.Fatalf("expected no manager and contact, got %#v", employees)
+		}
+		if m := employees[1].Manager; m == nil || m.ID != 1 || m.Name != "Boss" {
+			t.Errorf("expected the Boss as manager, got %#v", m)
+		}
+
+		var e employee
+		if err := db.Get(&e, query+" LIMIT 1"); err != nil {
+			t.Fatal(err)
+		}
+		if e.Name != "Boss" || e.Manager != nil {
+			t.Errorf("expected no manager, got %#v", e)
+		}
+
+		// NULL columns under a pointer which isn't nil are scanned as usual
+		type nullable struct {
+			ID   int
+			Name sql.NullString
+		}
+		type partial struct {
+			ID      int
+			Manager *nullable `db:"manager"`
+		}
+		partialQuery := `SELECT e.id, m.id AS "manager.id", NULL AS "manager.name" FROM employee e LEFT JOIN employee m ON m.id = e.manager_id ORDER BY e.id`
+		var partials []partial
+		if err := db.Select(&partials, partialQuery); err != nil {
+			t.Fatal(err)
+		}
+		if len(partials) != 2 || partials[0].Manager != nil || partials[1].Manager == nil || partials[1].Manager.Name.Valid {
+			t.Errorf("unexpected employees %#v", partials)
+		}
+		badQuery := `SELECT e.id, e.name, m.name AS "manager.name", NULL AS "manager.id" FROM employee e LEFT JOIN employee m ON m.id = e.manager_id ORDER BY e.id`
+		if err := db.Select(&employees, badQuery); err == nil || !strings.Contains(err.Error(), "converting NULL to int") {
+			t.Errorf("expected a NULL conversion error, got %v", err)
+		}
+		if err := db.Get(&e, badQuery+" DESC LIMIT 1"); err == nil || !strings.Contains(err.Error(), "converting NULL to int") {
+			t.Errorf("expected a NULL conversion error, got %v", err)
+		}
+
+		// a reused destination loses its manager for the rows without one
+		rows, err := db.Queryx(query + " DESC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var managers []*person
+		for rows.Next() {
+			if err := rows.StructScan(&e); err != nil {
+				t.Fatal(err)
+			}
+			managers = append(managers, e.Manager)
+		}
+		if len(managers) != 2 || managers[0] == nil || managers[1] != nil {
+			t.Errorf("expected a manager then none, got %#v", managers)
+		}
+	})
+}